@@ -6,5 +6,12 @@ replace example.com/lvapi => ./lvapi
 
 require (
 	example.com/lvapi v0.0.0-00010101000000-000000000002
+	github.com/andybalholm/brotli v1.0.4
 	github.com/gorilla/mux v1.8.0
+	github.com/prometheus/client_golang v1.11.1
+	go.opentelemetry.io/otel v1.3.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.3.0
+	go.opentelemetry.io/otel/sdk v1.3.0
+	go.opentelemetry.io/otel/trace v1.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,119 @@
+package lvapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Time the circuit breaker stays open after its first trip, doubled by every trip that follows
+// a trial request until it reaches maxCircuitCooldown
+const (
+	minCircuitCooldown = 30 * time.Second
+	maxCircuitCooldown = 10 * time.Minute
+)
+
+// Circuit breaker shared by every request lvapi crawls
+var (
+	circuitMu       sync.Mutex
+	circuitCooldown time.Duration // Cooldown of the last trip, zero while closed
+	circuitOpenTill time.Time     // Time requests are let through again
+)
+
+// A CircuitOpenError is returned, without sending a request, while the circuit breaker is open
+// because the LV API blocked a request. It matches ErrBlocked with errors.Is.
+type CircuitOpenError struct {
+	RetryAfter time.Duration // Time until the circuit breaker lets requests through again
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, not sending requests for %s", ErrBlocked, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrBlocked.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// CircuitRetryAfter returns the time until the circuit breaker lets requests through again,
+// zero if it is closed.
+func CircuitRetryAfter() time.Duration {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	if wait := time.Until(circuitOpenTill); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// tripCircuit opens the circuit breaker after the LV API blocked a request, for the Retry-After
+// of the response if it is longer than the cooldown. Requests let through after a cooldown are
+// trial requests: if they are blocked as well, the cooldown doubles.
+func tripCircuit(retryAfter string) {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	if time.Now().Before(circuitOpenTill) {
+		// Requests sent before the trip are still answering
+		return
+	}
+	cooldown := minCircuitCooldown
+	if circuitCooldown > 0 {
+		cooldown = circuitCooldown * 2
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && time.Duration(seconds)*time.Second > cooldown {
+		cooldown = time.Duration(seconds) * time.Second
+	}
+	if cooldown > maxCircuitCooldown {
+		cooldown = maxCircuitCooldown
+	}
+	circuitCooldown = cooldown
+	circuitOpenTill = time.Now().Add(cooldown)
+	Warn(context.Background(), "LV API blocked a request, circuit breaker open", F("cooldown", cooldown))
+}
+
+// closeCircuit closes the circuit breaker after the LV API answered a request.
+func closeCircuit() {
+	circuitMu.Lock()
+	defer circuitMu.Unlock()
+	if !time.Now().Before(circuitOpenTill) {
+		circuitCooldown = 0
+	}
+}
+
+// breakCollector trips the circuit breaker whenever the LV API blocks a request made by c,
+// and closes it whenever the LV API answers one.
+func breakCollector(c *colly.Collector) {
+	c.OnResponse(func(r *colly.Response) {
+		closeCircuit()
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if errors.Is(newUpstreamError(r, err), ErrBlocked) {
+			retryAfter := ""
+			if r.Headers != nil {
+				retryAfter = r.Headers.Get("Retry-After")
+			}
+			tripCircuit(retryAfter)
+		} else if r.StatusCode != 0 {
+			closeCircuit()
+		}
+	})
+}
+
+// visit makes c, created for ctx, visit url unless the circuit breaker is open.
+// It returns a *CircuitOpenError while the breaker is open, the error of c.Visit if it failed,
+// and ctx.Err() if ctx is done, as a request abandoned while waiting for its turn is neither
+// sent nor reported to the OnError callbacks of c.
+func visit(ctx context.Context, c *colly.Collector, url string) error {
+	if wait := CircuitRetryAfter(); wait > 0 {
+		return &CircuitOpenError{RetryAfter: wait}
+	}
+	if err := c.Visit(url); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,65 @@
+package lvapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gocolly/colly"
+)
+
+// ErrUnknownSKU is returned when the LV catalog does not list a product sku.
+var ErrUnknownSKU = errors.New("unknown sku")
+
+// ErrUnexpectedResponse is returned when an LV API response cannot be parsed.
+var ErrUnexpectedResponse = errors.New("unexpected response from LV API")
+
+// ErrImageTooLarge is returned when an image is larger than MaxImageSize.
+var ErrImageTooLarge = errors.New("image too large")
+
+// ErrInvalidSKU is returned, without making any request, for a sku that is not well formed.
+var ErrInvalidSKU = errors.New("malformed sku")
+
+// ErrBlocked matches, with errors.Is, an UpstreamError for a request the LV API refused or
+// rate limited, which usually clears up after a while.
+var ErrBlocked = errors.New("request blocked by LV API")
+
+// Matches a well formed product sku such as M40995 or 1A8XYZ
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9]{5,12}$`)
+
+// ValidateSKU returns ErrInvalidSKU if sku is not well formed.
+func ValidateSKU(sku string) error {
+	if !skuPattern.MatchString(sku) {
+		return ErrInvalidSKU
+	}
+	return nil
+}
+
+// An UpstreamError represents a failed request to an LV API endpoint.
+type UpstreamError struct {
+	URL        string // Requested URL
+	StatusCode int    // HTTP status code of the response, zero if no response was received
+	Err        error  // Underlying error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("request to %s failed with status %d: %v", e.URL, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("request to %s failed: %v", e.URL, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrBlocked and the LV API refused or rate limited the request.
+func (e *UpstreamError) Is(target error) bool {
+	return target == ErrBlocked && (e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusTooManyRequests)
+}
+
+// newUpstreamError creates an UpstreamError from a failed colly response.
+func newUpstreamError(r *colly.Response, err error) *UpstreamError {
+	return &UpstreamError{URL: r.Request.URL.String(), StatusCode: r.StatusCode, Err: err}
+}
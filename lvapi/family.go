@@ -0,0 +1,164 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Relations between the members of a ProductFamily
+const (
+	RelationColorVariant = "color_variant" // Same size in another color or canvas
+	RelationSizeVariant  = "size_variant"  // Same color or canvas in another size
+)
+
+// A FamilyRelation represents a relation between two skus of a ProductFamily.
+type FamilyRelation struct {
+	From     string `json:"From"`     // Product identifier the relation starts at
+	To       string `json:"To"`       // Product identifier the relation points to
+	Relation string `json:"Relation"` // Relation type
+}
+
+// A FamilyColor represents the skus of a ProductFamily sharing a color or canvas.
+type FamilyColor struct {
+	Color     string   `json:"Color"`     // Color or canvas
+	Skus      []string `json:"Skus"`      // Product identifiers in Color
+	Available bool     `json:"Available"` // At least one sku in Color is available
+}
+
+// A ProductFamily represents a parent product model with its color, canvas and size variants
+// and the relations between them.
+type ProductFamily struct {
+	Parent    string           `json:"Parent"`    // Parent model identifier
+	Name      string           `json:"Name"`      // Parent model name
+	Region    string           `json:"Region"`    // Region code the family was fetched from
+	Variants  []ProductVariant `json:"Variants"`  // Every sku in the family
+	Colors    []FamilyColor    `json:"Colors"`    // Skus grouped by color or canvas
+	Relations []FamilyRelation `json:"Relations"` // Relations between skus
+}
+
+// buildLVProductFamily groups variants by color and relates every pair of variants
+// sharing either their size or their color.
+func buildLVProductFamily(parent string, name string, region string, variants []ProductVariant) ProductFamily {
+	family := ProductFamily{Parent: parent, Name: name, Region: region, Variants: variants}
+	colorIndex := make(map[string]int)
+	for _, variant := range variants {
+		i, found := colorIndex[variant.Color]
+		if !found {
+			i = len(family.Colors)
+			colorIndex[variant.Color] = i
+			family.Colors = append(family.Colors, FamilyColor{Color: variant.Color})
+		}
+		family.Colors[i].Skus = append(family.Colors[i].Skus, variant.Sku)
+		family.Colors[i].Available = family.Colors[i].Available || variant.Available
+	}
+	for _, from := range variants {
+		for _, to := range variants {
+			if from.Sku == to.Sku {
+				continue
+			}
+			if from.Color != to.Color && from.Size == to.Size && from.Length == to.Length {
+				family.Relations = append(family.Relations, FamilyRelation{From: from.Sku, To: to.Sku, Relation: RelationColorVariant})
+			} else if from.Color == to.Color && (from.Size != to.Size || from.Length != to.Length) {
+				family.Relations = append(family.Relations, FamilyRelation{From: from.Sku, To: to.Sku, Relation: RelationSizeVariant})
+			}
+		}
+	}
+	sort.Slice(family.Colors, func(i, j int) bool { return family.Colors[i].Color < family.Colors[j].Color })
+	return family
+}
+
+// FetchLVProductFamily sends a request to the product API page for sku in region:
+//
+//	'https://api.louisvuitton.com/api/region/catalog/product/sku'
+//
+// It crawls and retrieves the JSON string from the endpoint.
+// The parent model and every model variant in the JSON are parsed into a ProductFamily graph.
+// It returns the ProductFamily. It returns ErrInvalidSKU without sending a request if sku is
+// malformed, ErrUnknownSKU if the product API does not list sku or any variant of it, an
+// *UpstreamError if the request failed, or ErrUnexpectedResponse if the response could not be parsed.
+func FetchLVProductFamily(ctx context.Context, sku string, region string) (ProductFamily, error) {
+	ctx, span := startSpan(ctx, "lvapi.FetchLVProductFamily", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return ProductFamily{}, err
+	}
+	// Output family
+	var family ProductFamily
+	var fetchErr error
+	// REST API endpoint for LV SKU catalog
+	endpoint := apiURL(region, "/catalog/product/"+sku)
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointProduct)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
+	})
+	// Response body contains the JSON string from API endpoint.
+	// The top level of the JSON describes the parent model and each model is a variant.
+	c.OnResponse(func(r *colly.Response) {
+		_, parseSpan := startSpan(ctx, "lvapi.parseProductJSON")
+		defer parseSpan.End()
+		var result map[string]interface{}
+		if err := json.Unmarshal(r.Body, &result); err != nil {
+			observeParseFailure(EndpointProduct)
+			fetchErr = ErrUnexpectedResponse
+			return
+		}
+		if result["errorCode"] != nil {
+			fetchErr = ErrUnknownSKU
+			return
+		}
+		var variants []ProductVariant
+		models, _ := result["model"].([]interface{})
+		for _, m := range models {
+			item, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if variant, ok := parseLVProductVariant(item); ok {
+				variants = append(variants, variant)
+			}
+		}
+		if len(variants) == 0 {
+			fetchErr = ErrUnknownSKU
+			return
+		}
+		parent := sku
+		for _, key := range []string{"productID", "productId", "identifier"} {
+			if id, ok := result[key].(string); ok && id != "" {
+				parent = id
+				break
+			}
+		}
+		name, _ := result["name"].(string)
+		family = buildLVProductFamily(parent, name, region, variants)
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	if fetchErr != nil {
+		return ProductFamily{}, fetchErr
+	}
+	return family, nil
+}
+
+// GetLVProductFamilyBySKU returns the family of sku in region the same way as FetchLVProductFamily.
+// It returns the ProductFamily and false if the product could not be found.
+func GetLVProductFamilyBySKU(ctx context.Context, sku string, region string) (ProductFamily, bool) {
+	family, err := FetchLVProductFamily(ctx, sku, region)
+	return family, err == nil
+}
@@ -0,0 +1,297 @@
+package lvapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNoLink is returned when a resource has no link with the requested relation.
+var ErrNoLink = errors.New("no link with relation")
+
+// A Link represents the target of a HAL link relation.
+type Link struct {
+	Href      string `json:"href"`                // Target URL, a URI template if Templated is set
+	Templated bool   `json:"templated,omitempty"` // Whether Href must be expanded before it is followed
+	Name      string `json:"name,omitempty"`      // Name telling apart links with the same relation
+	Title     string `json:"title,omitempty"`     // Human readable label
+	Type      string `json:"type,omitempty"`      // Media type of the target
+}
+
+// Links holds the link relations of a HAL resource keyed by relation name.
+// HAL allows a relation to hold a single link or an array of links, both decode into a slice.
+type Links map[string][]Link
+
+// UnmarshalJSON decodes a HAL _links object.
+func (l *Links) UnmarshalJSON(data []byte) error {
+	var relations map[string]json.RawMessage
+	if err := json.Unmarshal(data, &relations); err != nil {
+		return err
+	}
+	*l = make(Links, len(relations))
+	for rel, raw := range relations {
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 && raw[0] == '[' {
+			var links []Link
+			if err := json.Unmarshal(raw, &links); err != nil {
+				return err
+			}
+			(*l)[rel] = links
+			continue
+		}
+		var link Link
+		if err := json.Unmarshal(raw, &link); err != nil {
+			return err
+		}
+		(*l)[rel] = []Link{link}
+	}
+	return nil
+}
+
+// A Resource represents a HAL resource returned by the LV API: its link relations, its
+// embedded resources and its remaining properties.
+type Resource struct {
+	URL        string                     // URL the resource was fetched from, relative links resolve against it
+	Links      Links                      // Link relations from _links
+	Embedded   map[string][]Resource      // Embedded resources from _embedded, keyed by relation
+	Properties map[string]json.RawMessage // Every other property, undecoded
+}
+
+// ParseResource parses data as a HAL resource fetched from base.
+// It returns the parsed Resource, or an error if data is not a JSON object.
+func ParseResource(data []byte, base string) (Resource, error) {
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return Resource{}, err
+	}
+	resource := Resource{URL: base, Links: Links{}, Embedded: make(map[string][]Resource), Properties: properties}
+	if raw, found := properties["_links"]; found {
+		if err := json.Unmarshal(raw, &resource.Links); err != nil {
+			return Resource{}, err
+		}
+		delete(properties, "_links")
+	}
+	if raw, found := properties["_embedded"]; found {
+		var embedded map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &embedded); err != nil {
+			return Resource{}, err
+		}
+		for rel, raw := range embedded {
+			resources, err := parseResources(raw, base)
+			if err != nil {
+				return Resource{}, err
+			}
+			resource.Embedded[rel] = resources
+		}
+		delete(properties, "_embedded")
+	}
+	return resource, nil
+}
+
+// parseResources parses raw, a single resource or an array of resources, fetched from base.
+func parseResources(raw json.RawMessage, base string) ([]Resource, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' {
+		resource, err := ParseResource(raw, base)
+		return []Resource{resource}, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	resources := make([]Resource, 0, len(items))
+	for _, item := range items {
+		resource, err := ParseResource(item, base)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// Decode decodes the properties of r into v, as json.Unmarshal would the whole resource.
+func (r Resource) Decode(v interface{}) error {
+	data, err := json.Marshal(r.Properties)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// List parses the array property named property as resources, for responses that list
+// resources in a plain property such as skuList rather than in _embedded.
+// It returns nil if r has no such property.
+func (r Resource) List(property string) ([]Resource, error) {
+	raw, found := r.Properties[property]
+	if !found {
+		return nil, nil
+	}
+	return parseResources(raw, r.URL)
+}
+
+// Link returns the first link of r with relation rel and whether there is one.
+func (r Resource) Link(rel string) (Link, bool) {
+	links := r.Links[rel]
+	if len(links) == 0 {
+		return Link{}, false
+	}
+	return links[0], true
+}
+
+// Href returns the absolute URL of the first link of r with relation rel, expanding a templated
+// link with vars. Links to the default API host are pointed at the host set by SetHosts.
+// It returns ErrNoLink if r has no link with relation rel.
+func (r Resource) Href(rel string, vars map[string]string) (string, error) {
+	link, found := r.Link(rel)
+	if !found {
+		return "", ErrNoLink
+	}
+	href := link.Href
+	if link.Templated {
+		href = expandTemplate(href, vars)
+	}
+	return resolveHref(r.URL, href)
+}
+
+// Follow fetches the resource linked from r with relation rel, expanding a templated link with vars.
+// It returns ErrNoLink if r has no such link, an *UpstreamError if the request failed, or
+// ErrUnexpectedResponse if the response is not a HAL resource.
+func (r Resource) Follow(ctx context.Context, rel string, vars map[string]string) (Resource, error) {
+	href, err := r.Href(rel, vars)
+	if err != nil {
+		return Resource{}, err
+	}
+	return FetchResource(ctx, href)
+}
+
+// resolveHref resolves href against base, replacing the default API host with the current one.
+func resolveHref(base string, href string) (string, error) {
+	target, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	if baseURL, err := url.Parse(base); err == nil {
+		target = baseURL.ResolveReference(target)
+	}
+	if defaultAPI, err := url.Parse(DefaultHosts.API); err == nil && target.Host == defaultAPI.Host {
+		if currentAPI, err := url.Parse(currentHosts().API); err == nil {
+			target.Scheme, target.Host = currentAPI.Scheme, currentAPI.Host
+		}
+	}
+	return target.String(), nil
+}
+
+// Matches an RFC 6570 expression such as {sku} or {?storeIds,lang}
+var templateExpression = regexp.MustCompile(`\{([?&]?)([^}]*)\}`)
+
+// expandTemplate expands the simple string and form query expressions of the URI template href
+// with vars. Variables missing from vars expand to nothing.
+func expandTemplate(href string, vars map[string]string) string {
+	return templateExpression.ReplaceAllStringFunc(href, func(expression string) string {
+		match := templateExpression.FindStringSubmatch(expression)
+		operator, names := match[1], strings.Split(match[2], ",")
+		if operator == "" {
+			var values []string
+			for _, name := range names {
+				if value, found := vars[name]; found {
+					values = append(values, url.PathEscape(value))
+				}
+			}
+			return strings.Join(values, ",")
+		}
+		var pairs []string
+		for _, name := range names {
+			if value, found := vars[name]; found {
+				pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+			}
+		}
+		if len(pairs) == 0 {
+			return ""
+		}
+		return operator + strings.Join(pairs, "&")
+	})
+}
+
+// FetchResource sends a request to the LV API at href and parses the response as a HAL resource.
+// It returns an *UpstreamError if the request failed, or ErrUnexpectedResponse if the response
+// is not a HAL resource.
+func FetchResource(ctx context.Context, href string) (Resource, error) {
+	ctx, span := startSpan(ctx, "lvapi.FetchResource", attribute.String("lv.url", href))
+	defer span.End()
+	return fetchResource(ctx, href, EndpointLink)
+}
+
+// fetchResource implements FetchResource, reporting the request to the Observer as endpoint.
+func fetchResource(ctx context.Context, href string, endpoint string) (Resource, error) {
+	var resource Resource
+	var fetchErr error
+	// Init colly collector
+	c := createCollyCollector(ctx, endpoint)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("Accept", "application/hal+json, application/json")
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+	})
+	// Response body contains the JSON resource
+	c.OnResponse(func(r *colly.Response) {
+		var err error
+		if resource, err = ParseResource(r.Body, r.Request.URL.String()); err != nil {
+			observeParseFailure(endpoint)
+			fetchErr = ErrUnexpectedResponse
+		}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, href); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: href, Err: err}
+	}
+	if fetchErr != nil {
+		return Resource{}, fetchErr
+	}
+	if resource.URL == "" {
+		return Resource{}, ErrUnexpectedResponse
+	}
+	return resource, nil
+}
+
+// GetLVSKUResource sends a request to the SKU catalog for sku and parses it as a HAL resource.
+// Its skuList property lists a resource per matching product whose links lead to the product,
+// its variants and its stock, see Resource.List and Resource.Follow.
+// It returns ErrInvalidSKU without sending a request if sku is malformed, ErrUnknownSKU if the
+// catalog does not list sku, or the errors of FetchResource.
+func GetLVSKUResource(ctx context.Context, sku string) (Resource, error) {
+	ctx, span := startSpan(ctx, "lvapi.GetLVSKUResource", attribute.String("lv.sku", sku))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return Resource{}, err
+	}
+	resource, err := fetchResource(ctx, apiURL(DefaultRegion, "/catalog/skus/"+sku), EndpointSKU)
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusNotFound {
+		return Resource{}, ErrUnknownSKU
+	}
+	if err != nil {
+		return Resource{}, err
+	}
+	entries, err := resource.List("skuList")
+	if err != nil {
+		return Resource{}, ErrUnexpectedResponse
+	}
+	if len(entries) == 0 {
+		return Resource{}, ErrUnknownSKU
+	}
+	return resource, nil
+}
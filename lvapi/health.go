@@ -0,0 +1,36 @@
+package lvapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Client used to check whether the LV API is reachable
+var pingClient = &http.Client{Timeout: 5 * time.Second}
+
+// PingUpstream sends a request to the LV API host to check that it is reachable.
+// Any response below 500 counts as reachable, the API answers unknown paths with an error status.
+// It returns an UpstreamError if no response was received or the API responded with a server error.
+func PingUpstream(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "lvapi.PingUpstream")
+	defer span.End()
+	endpoint := currentHosts().API
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return &UpstreamError{URL: endpoint, Err: err}
+	}
+	start := time.Now()
+	response, err := pingClient.Do(request)
+	if err != nil {
+		currentObserver().ObserveRequest(EndpointPing, "", 0, time.Since(start))
+		Debug(ctx, "upstream unreachable", F("url", endpoint), F("error", err))
+		return &UpstreamError{URL: endpoint, Err: err}
+	}
+	response.Body.Close()
+	currentObserver().ObserveRequest(EndpointPing, "", response.StatusCode, time.Since(start))
+	if response.StatusCode >= http.StatusInternalServerError {
+		return &UpstreamError{URL: endpoint, StatusCode: response.StatusCode, Err: ErrUnexpectedResponse}
+	}
+	return nil
+}
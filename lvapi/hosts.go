@@ -0,0 +1,47 @@
+package lvapi
+
+import "sync"
+
+// Hosts represents the base URLs lvapi sends requests to, without a trailing slash.
+type Hosts struct {
+	API     string // Catalog, product and store API
+	Website string // Website crawled for region codes
+}
+
+// DefaultHosts are the Louis Vuitton hosts lvapi sends requests to unless SetHosts is called.
+var DefaultHosts = Hosts{
+	API:     "https://api.louisvuitton.com",
+	Website: "https://www.louisvuitton.com",
+}
+
+// Hosts lvapi sends requests to
+var (
+	hostsMu sync.RWMutex
+	hosts   = DefaultHosts
+)
+
+// SetHosts replaces the hosts lvapi sends requests to, such as a proxy or a mirror.
+// Empty fields keep their default host.
+func SetHosts(h Hosts) {
+	if h.API == "" {
+		h.API = DefaultHosts.API
+	}
+	if h.Website == "" {
+		h.Website = DefaultHosts.Website
+	}
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	hosts = h
+}
+
+// currentHosts returns the hosts set by SetHosts.
+func currentHosts() Hosts {
+	hostsMu.RLock()
+	defer hostsMu.RUnlock()
+	return hosts
+}
+
+// apiURL returns the URL of path on the API host in region, path starting with a slash.
+func apiURL(region string, path string) string {
+	return currentHosts().API + "/api/" + region + path
+}
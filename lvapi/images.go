@@ -0,0 +1,230 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Largest image DownloadImage accepts, in bytes. Product images are a few hundred kilobytes.
+const MaxImageSize = 5 << 20
+
+// An Image represents an image downloaded from the LV CDN.
+type Image struct {
+	URL         string // URL the image was downloaded from
+	ContentType string // Media type of the image, such as image/jpeg
+	Data        []byte // Image content
+}
+
+// Attributes of an img tag holding its source, best first. Product lists lazy-load their
+// images, leaving a placeholder in src until the real source is copied from data-srcset or data-src.
+var imageSourceAttributes = []string{"data-srcset", "srcset", "data-src", "src"}
+
+// imageSource returns the URL of the largest real image of the img tag el, skipping
+// lazy-load placeholders. It returns an empty string if el only has a placeholder.
+func imageSource(el *goquery.Selection) string {
+	for _, attribute := range imageSourceAttributes {
+		value, found := el.Attr(attribute)
+		if !found {
+			continue
+		}
+		if strings.HasSuffix(attribute, "srcset") {
+			value = largestSrcsetCandidate(value)
+		}
+		if value = strings.TrimSpace(value); value != "" && !isPlaceholderImage(value) {
+			return value
+		}
+	}
+	return ""
+}
+
+// isPlaceholderImage returns whether src is a lazy-load placeholder rather than a product image.
+func isPlaceholderImage(src string) bool {
+	lower := strings.ToLower(src)
+	return strings.HasPrefix(lower, "data:") || strings.Contains(lower, "placeholder") || strings.Contains(lower, "blank.gif")
+}
+
+// largestSrcsetCandidate returns the URL of the widest candidate of srcset, such as
+// "a.jpg 320w, b.jpg 640w", or of the highest density for x descriptors.
+// It returns an empty string if srcset lists no candidate.
+func largestSrcsetCandidate(srcset string) string {
+	largest, largestSize := "", -1.0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		// A candidate without descriptor counts as 1x
+		size := 1.0
+		if len(fields) > 1 {
+			descriptor := fields[len(fields)-1]
+			if value, err := strconv.ParseFloat(strings.TrimRight(descriptor, "wxh"), 64); err == nil {
+				size = value
+			}
+		}
+		if size > largestSize {
+			largest, largestSize = fields[0], size
+		}
+	}
+	return largest
+}
+
+// lvProductImageURLs returns the image URLs of a product model item. The image of an item may
+// be a URL, an ImageObject or a list of either.
+func lvProductImageURLs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" && !isPlaceholderImage(v) {
+			return []string{v}
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"contentUrl", "url"} {
+			if url, ok := v[key].(string); ok && url != "" {
+				return lvProductImageURLs(url)
+			}
+		}
+	case []interface{}:
+		var urls []string
+		for _, item := range v {
+			urls = append(urls, lvProductImageURLs(item)...)
+		}
+		return urls
+	}
+	return nil
+}
+
+// GetLVProductImageURLsBySKU sends a request to the product API page for sku in region:
+//
+//	'https://api.louisvuitton.com/api/region/catalog/product/sku'
+//
+// It returns the URLs of the images of the model identified by sku, without duplicates.
+// It returns ErrInvalidSKU without sending a request if sku is malformed, ErrUnknownSKU if the
+// catalog does not list sku, an *UpstreamError if the request failed, or ErrUnexpectedResponse
+// if the response could not be parsed.
+func GetLVProductImageURLsBySKU(ctx context.Context, sku string, region string) ([]string, error) {
+	ctx, span := startSpan(ctx, "lvapi.GetLVProductImageURLsBySKU", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return nil, err
+	}
+	// REST API endpoint for LV SKU catalog
+	endpoint := apiURL(region, "/catalog/product/"+sku)
+	var urls []string
+	var fetchErr error
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointProduct)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
+	})
+	// Response body contains the JSON string from API endpoint.
+	// The images of the model matching sku are listed in its image property.
+	c.OnResponse(func(r *colly.Response) {
+		_, parseSpan := startSpan(ctx, "lvapi.parseProductJSON")
+		defer parseSpan.End()
+		var result map[string]interface{}
+		if err := json.Unmarshal(r.Body, &result); err != nil {
+			observeParseFailure(EndpointProduct)
+			fetchErr = ErrUnexpectedResponse
+			return
+		}
+		if result["errorCode"] != nil {
+			fetchErr = ErrUnknownSKU
+			return
+		}
+		models, ok := result["model"].([]interface{})
+		if !ok {
+			observeParseFailure(EndpointProduct)
+			fetchErr = ErrUnexpectedResponse
+			return
+		}
+		fetchErr = ErrUnknownSKU
+		seen := make(map[string]bool)
+		for _, m := range models {
+			item, ok := m.(map[string]interface{})
+			if !ok || item["identifier"] != sku {
+				continue
+			}
+			fetchErr = nil
+			for _, url := range lvProductImageURLs(item["image"]) {
+				url = r.Request.AbsoluteURL(url)
+				if url != "" && !seen[url] {
+					seen[url] = true
+					urls = append(urls, url)
+				}
+			}
+		}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	return urls, fetchErr
+}
+
+// DownloadImage sends a request to url and returns the image it responds with.
+// It returns an *UpstreamError if the request failed, ErrUnexpectedResponse if the response
+// is not an image, or ErrImageTooLarge if it is larger than MaxImageSize.
+func DownloadImage(ctx context.Context, url string) (Image, error) {
+	ctx, span := startSpan(ctx, "lvapi.DownloadImage", attribute.String("lv.url", url))
+	defer span.End()
+	var image Image
+	var fetchErr error
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointImage)
+	// Bodies are truncated past MaxBodySize, one byte more tells a truncated image from one of MaxImageSize
+	c.MaxBodySize = MaxImageSize + 1
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		r.Headers.Set("Accept", "image/*")
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+	})
+	// Response body is the image, sniffed when the CDN does not label it
+	c.OnResponse(func(r *colly.Response) {
+		if len(r.Body) > MaxImageSize {
+			fetchErr = ErrImageTooLarge
+			return
+		}
+		contentType := r.Headers.Get("Content-Type")
+		if !strings.HasPrefix(contentType, "image/") {
+			contentType = http.DetectContentType(r.Body)
+		}
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			contentType = mediaType
+		}
+		if !strings.HasPrefix(contentType, "image/") {
+			observeParseFailure(EndpointImage)
+			fetchErr = ErrUnexpectedResponse
+			return
+		}
+		image = Image{URL: r.Request.URL.String(), ContentType: contentType, Data: r.Body}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, url); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: url, Err: err}
+	}
+	if fetchErr == nil && image.Data == nil {
+		fetchErr = ErrUnexpectedResponse
+	}
+	return image, fetchErr
+}
@@ -0,0 +1,103 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A ProductLink represents the product page of a product in the store of one region.
+type ProductLink struct {
+	Region string `json:"Region"` // Region code
+	URL    string `json:"URL"`    // Localized product page URL
+}
+
+// A ProductPage represents an entry of the SKU catalog with its product page in every region.
+type ProductPage struct {
+	Sku       string        `json:"Sku"`       // Product identifier
+	Name      string        `json:"Name"`      // Product name
+	Route     string        `json:"Route"`     // Product page route as listed, specific to DefaultRegion
+	ListedURL string        `json:"ListedURL"` // Product page URL of Route on the website, in the DefaultRegion store
+	Links     []ProductLink `json:"Links"`     // Product page URL in the store of each region
+}
+
+// A skuCatalogEntry represents an entry of the skuList of the SKU catalog.
+type skuCatalogEntry struct {
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+}
+
+// GetLVProductPagesBySKU sends a request to getLVProductJSONBodyBySKU.
+// Every skuList entry of the response is returned with its product page URL as listed and
+// its localized product page URL in each of regions, as returned by GetLVRegionCodesAndURLs.
+// It returns ErrInvalidSKU without sending a request if sku is malformed, ErrUnknownSKU if the
+// catalog does not list sku, an *UpstreamError if the request failed, or ErrUnexpectedResponse
+// if the response could not be parsed.
+func GetLVProductPagesBySKU(ctx context.Context, sku string, regions []RegionURL) ([]ProductPage, error) {
+	ctx, span := startSpan(ctx, "lvapi.GetLVProductPagesBySKU", attribute.String("lv.sku", sku))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return nil, err
+	}
+	jsonString, err := getLVProductJSONBodyBySKU(ctx, sku)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		SkuList []skuCatalogEntry `json:"skuList"`
+	}
+	if err := json.Unmarshal([]byte(jsonString), &result); err != nil {
+		observeParseFailure(EndpointSKU)
+		return nil, ErrUnexpectedResponse
+	}
+	if len(result.SkuList) == 0 {
+		return nil, ErrUnknownSKU
+	}
+	pages := []ProductPage{}
+	for _, entry := range result.SkuList {
+		if entry.URL == "" {
+			continue
+		}
+		page := ProductPage{Sku: entry.Identifier, Name: entry.Name, Route: entry.URL, ListedURL: entry.URL, Links: []ProductLink{}}
+		if page.Sku == "" {
+			page.Sku = sku
+		}
+		if strings.HasPrefix(entry.URL, "/") {
+			page.ListedURL = currentHosts().Website + entry.URL
+		}
+		for _, region := range regions {
+			if link := localizeRoute(entry.URL, region); link != "" {
+				page.Links = append(page.Links, ProductLink{Region: region.Code, URL: link})
+			}
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// localizeRoute returns the URL of the product page at route in the store of region, replacing
+// the region code route starts with. route may be a path or an absolute URL.
+// It returns an empty string if region has no valid store URL.
+func localizeRoute(route string, region RegionURL) string {
+	store, err := url.Parse(region.URL)
+	if err != nil || store.Host == "" {
+		return ""
+	}
+	page, err := url.Parse(route)
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(strings.TrimPrefix(page.Path, "/"), "/")
+	if len(segments) > 0 && regionPattern.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+	localized := url.URL{Scheme: store.Scheme, Host: store.Host, Path: "/" + region.Code + "/" + strings.Join(segments, "/")}
+	if localized.Scheme == "" {
+		localized.Scheme = "https"
+	}
+	return localized.String()
+}
@@ -0,0 +1,185 @@
+package lvapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Level represents the severity of a log entry.
+type Level int
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level named s, one of debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+// A Field represents a key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a Field from key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// A Logger writes log entries. Implementations must be safe for concurrent use.
+// ctx carries the request ID of the entry, if any.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// A StreamLogger writes log entries at or above a minimum level to a writer,
+// either as logfmt style text or as one JSON object per line.
+type StreamLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+	json  bool
+}
+
+// NewTextLogger creates a StreamLogger writing text entries at or above level to w.
+// It returns the created StreamLogger.
+func NewTextLogger(w io.Writer, level Level) *StreamLogger {
+	return &StreamLogger{w: w, level: level}
+}
+
+// NewJSONLogger creates a StreamLogger writing JSON entries at or above level to w.
+// It returns the created StreamLogger.
+func NewJSONLogger(w io.Writer, level Level) *StreamLogger {
+	return &StreamLogger{w: w, level: level, json: true}
+}
+
+// Log writes an entry with msg and fields if level is at or above the minimum level of l.
+// The request ID carried by ctx is added as the request_id field.
+func (l *StreamLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if level < l.level {
+		return
+	}
+	if id := RequestID(ctx); id != "" {
+		fields = append([]Field{F("request_id", id)}, fields...)
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var line []byte
+	if l.json {
+		entry := map[string]interface{}{"time": now, "level": level.String(), "msg": msg}
+		for _, field := range fields {
+			if err, ok := field.Value.(error); ok {
+				entry[field.Key] = err.Error()
+			} else {
+				entry[field.Key] = field.Value
+			}
+		}
+		line, _ = json.Marshal(entry)
+	} else {
+		var b strings.Builder
+		fmt.Fprintf(&b, "time=%s level=%s msg=%q", now, level, msg)
+		for _, field := range fields {
+			fmt.Fprintf(&b, " %s=%s", field.Key, formatLogValue(field.Value))
+		}
+		line = []byte(b.String())
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(line, '\n'))
+}
+
+// formatLogValue formats a text log value, quoting it if it contains spaces or quotes.
+func formatLogValue(value interface{}) string {
+	s := fmt.Sprintf("%v", value)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// Logger used by lvapi and its callers, text entries at info level on stderr by default
+var (
+	loggerMu sync.RWMutex
+	logger   Logger = NewTextLogger(os.Stderr, LevelInfo)
+)
+
+// SetLogger replaces the logger used by lvapi.
+func SetLogger(l Logger) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// Log writes an entry to the logger set by SetLogger.
+func Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	loggerMu.RLock()
+	l := logger
+	loggerMu.RUnlock()
+	l.Log(ctx, level, msg, fields...)
+}
+
+// Debug writes a debug entry to the logger set by SetLogger.
+func Debug(ctx context.Context, msg string, fields ...Field) { Log(ctx, LevelDebug, msg, fields...) }
+
+// Info writes an info entry to the logger set by SetLogger.
+func Info(ctx context.Context, msg string, fields ...Field) { Log(ctx, LevelInfo, msg, fields...) }
+
+// Warn writes a warn entry to the logger set by SetLogger.
+func Warn(ctx context.Context, msg string, fields ...Field) { Log(ctx, LevelWarn, msg, fields...) }
+
+// Error writes an error entry to the logger set by SetLogger.
+func Error(ctx context.Context, msg string, fields ...Field) { Log(ctx, LevelError, msg, fields...) }
+
+// requestIDKey is the context key holding the request ID.
+type requestIDKey struct{}
+
+// RequestIDHeader is the HTTP header request IDs are read from and echoed back in.
+const RequestIDHeader = "X-Request-ID"
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
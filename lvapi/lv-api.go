@@ -1,70 +1,100 @@
 package lvapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly"
 	"github.com/gocolly/colly/extensions"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// DefaultRegion is the region code used for catalog API requests.
+const DefaultRegion = "eng-ca"
+
 // A RegionURL represents a region object containing the relevant data
 // for a Louis Vuitton region identifier.
 type RegionURL struct {
-	code string // Region Code
-	url  string // Main landing page URL for specified region code
+	Code string `json:"Code"` // Region Code
+	URL  string `json:"URL"`  // Main landing page URL for specified region code
 }
 
 // A CategoryURL represents a subcategory object containing a subcategory name
 // and the corresponding route to the subcategory page.
 type CategoryURL struct {
-	name string // Subcategory name
-	url  string // Subcategory URL/route
+	Name string `json:"Name"` // Subcategory name
+	URL  string `json:"URL"`  // Subcategory URL/route
 }
 
 // A ProductRoute represents a product page url and its corresponding product name.
 type ProductRoute struct {
-	name  string // Product name
-	route string // Product route
+	Name  string `json:"Name"`  // Product name
+	Route string `json:"Route"` // Product route
 }
 
 // A ProductImage represents a product name with its matching product image url.
 type ProductImage struct {
-	name string // Product name
-	url  string // Product image URL
+	Name string `json:"Name"` // Product name
+	URL  string `json:"URL"`  // Product image URL
 }
 
 // A ProductAvailability represents a product identifier sku with its online availability
+// and the price listed alongside it.
 type ProductAvailability struct {
-	Sku       string `json:"Sku"`       // Product identifier
-	Available bool   `json:"Available"` // Product availability
+	Sku       string  `json:"Sku"`       // Product identifier
+	Available bool    `json:"Available"` // Product availability
+	Price     float64 `json:"Price"`     // Product price, zero if not listed
+	Currency  string  `json:"Currency"`  // Product price currency code
 }
 
-// createCollyCollector creates a new gocolly collector and assigns random user agent.
+// createCollyCollector creates a new gocolly collector for ctx and assigns random user agent.
+// Every request made by the collector is reported to the Observer as a request to endpoint
+// and traced as a child of the span in ctx.
 // It returns the created gocolly collector.
-func createCollyCollector() *colly.Collector {
+func createCollyCollector(ctx context.Context, endpoint string) *colly.Collector {
 	// Init colly collector
 	c := colly.NewCollector(
 		colly.AllowURLRevisit(),
 	)
+	// Wait for the politeness limit before anything else, abandoning the request if ctx is done
+	c.OnRequest(func(r *colly.Request) {
+		if err := waitForTurn(ctx); err != nil {
+			r.Abort()
+		}
+	})
 	// Random UA on each access to prevent blacklisting
 	extensions.RandomUserAgent(c)
 	extensions.Referer(c)
+	// Carry the request ID of ctx in the colly request context so each visit can be
+	// traced back to the request that caused it. It is not sent upstream.
+	if id := RequestID(ctx); id != "" {
+		c.OnRequest(func(r *colly.Request) {
+			r.Ctx.Put("request_id", id)
+		})
+	}
+	observeCollector(c, endpoint)
+	breakCollector(c)
+	traceCollector(ctx, c, endpoint)
 	return c
 }
 
 // GetLVRegionCodesAndURLs sends a request to the Louis Vuitton landing page for crawling.
 // It crawls the page for region URLs.
 // It returns a map keyed by region codes with corresponding URL value for region.
-func GetLVRegionCodesAndURLs() []RegionURL {
+func GetLVRegionCodesAndURLs(ctx context.Context) []RegionURL {
+	ctx, span := startSpan(ctx, "lvapi.GetLVRegionCodesAndURLs")
+	defer span.End()
 	// Array for holding RegionURL structs which contain region code and corresponding url
 	var regionCodesAndURLs []RegionURL
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointRegions)
 	// Find within the children of each li tag anything with class .lvdispatch-link
 	// Use the value of that link as well as the region code contained within the link
 	// to create a a RegionURL struct. Then append the created struct to a slice for return.
@@ -73,25 +103,26 @@ func GetLVRegionCodesAndURLs() []RegionURL {
 		pageDom.Find(".lvdispatch-link").Each(func(i int, s *goquery.Selection) {
 			link, linkExists := s.Attr("href")
 			if linkExists {
-				regionCodeAndURL := RegionURL{code: strings.Split(link, "/")[3], url: link}
+				regionCodeAndURL := RegionURL{Code: strings.Split(link, "/")[3], URL: link}
 				regionCodesAndURLs = append(regionCodesAndURLs, regionCodeAndURL)
 			}
 		})
 	})
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
 	})
 	// Response Handler
 	c.OnResponse(func(r *colly.Response) {
 		//fmt.Println(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit("https://www.louisvuitton.com/dispatch/?noDRP=true")
+	visit(ctx, c, currentHosts().Website+"/dispatch/?noDRP=true")
+	listRegions(regionCodesAndURLs)
 
 	return regionCodesAndURLs
 }
@@ -99,11 +130,13 @@ func GetLVRegionCodesAndURLs() []RegionURL {
 // GetLVMainCategories sends a request to url for crawling.
 // It crawls url for the main nav bar item names.
 // It returns a slice of strings which are the category names.
-func GetLVMainCategories(url string) []string {
+func GetLVMainCategories(ctx context.Context, url string) []string {
+	ctx, span := startSpan(ctx, "lvapi.GetLVMainCategories", attribute.String("lv.url", url))
+	defer span.End()
 	// Slice to hold category names
 	var mainCategories []string
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointCategories)
 	// Find within the children of each li tag anything with class .lv-header-main-nav__item
 	// Append the text of that span to categories array
 	c.OnHTML("li", func(e *colly.HTMLElement) {
@@ -114,29 +147,31 @@ func GetLVMainCategories(url string) []string {
 	})
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
 	})
 	// Response Handler
 	c.OnResponse(func(r *colly.Response) {
 		//fmt.Println(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit(url)
+	visit(ctx, c, url)
 	return mainCategories
 }
 
 // GetLVSubCategoriesRoutes sends a request to url for crawling.
 // It crawls url based on mainCategory for subcateogries within the nav.
 // It returns a map containing the route of all subcategories under mainCategory with corresponding label as the key.
-func GetLVSubCategoriesRoutes(mainCategory string, url string) []CategoryURL {
+func GetLVSubCategoriesRoutes(ctx context.Context, mainCategory string, url string) []CategoryURL {
+	ctx, span := startSpan(ctx, "lvapi.GetLVSubCategoriesRoutes", attribute.String("lv.url", url), attribute.String("lv.category", mainCategory))
+	defer span.End()
 	// Slice to hold subcategory structs
 	var subCategories []CategoryURL
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointSubcategories)
 	// Find within the children of each li tag anything with class .lv-header-main-nav__item.
 	// Finds the span within the found class that matches mainCategory.
 	// Finds the corresponding subcategories within the parent to find all routes and subcategory labels.
@@ -151,7 +186,7 @@ func GetLVSubCategoriesRoutes(mainCategory string, url string) []CategoryURL {
 					Each(func(i int, s *goquery.Selection) {
 						href, hrefExists := s.Find(".lv-header-main-nav-child__link").Attr("href")
 						if hrefExists {
-							subCategory := CategoryURL{name: s.Find(".lv-header-main-nav-child__link").Text(), url: href}
+							subCategory := CategoryURL{Name: s.Find(".lv-header-main-nav-child__link").Text(), URL: href}
 							subCategories = append(subCategories, subCategory)
 						}
 					})
@@ -160,18 +195,18 @@ func GetLVSubCategoriesRoutes(mainCategory string, url string) []CategoryURL {
 	})
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
 	})
 	// Response Handler
 	c.OnResponse(func(r *colly.Response) {
 		//fmt.Println(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit(url)
+	visit(ctx, c, url)
 	return subCategories
 }
 
@@ -179,12 +214,14 @@ func GetLVSubCategoriesRoutes(mainCategory string, url string) []CategoryURL {
 // It crawls for each product contained in url which is the subcategory url.
 // It returns a slice of ProductRoute structures each containing the product name
 // and product route.
-func GetLVProductPageRoutes(url string) []ProductRoute {
+func GetLVProductPageRoutes(ctx context.Context, url string) []ProductRoute {
+	ctx, span := startSpan(ctx, "lvapi.GetLVProductPageRoutes", attribute.String("lv.url", url))
+	defer span.End()
 	// Slice containing ProductRoute objects
 	// Each product route is obtained from a subcategory page
 	var productPages []ProductRoute
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointProductRoutes)
 	// Find within the children of ul tag with class lv-list.
 	// Finds each .lv-product-card within the list
 	// Creates a ProductRoute structure using the product name and the product href into productPages.
@@ -198,7 +235,7 @@ func GetLVProductPageRoutes(url string) []ProductRoute {
 				productText.Find("img").Each(func(i int, el *goquery.Selection) {
 					//productImageSrc, productImageSrcExists := el.Attr("src")
 					el.Remove()
-					productRouteStruct := ProductRoute{name: strings.TrimSpace(productText.Text()), route: productRoute}
+					productRouteStruct := ProductRoute{Name: strings.TrimSpace(productText.Text()), Route: productRoute}
 					productPages = append(productPages, productRouteStruct)
 				})
 			}
@@ -206,29 +243,32 @@ func GetLVProductPageRoutes(url string) []ProductRoute {
 	})
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
 	})
 	// Response Handler
 	c.OnResponse(func(r *colly.Response) {
 		//fmt.Println(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit(url)
+	visit(ctx, c, url)
 	return productPages
 }
 
 // GetLVProductImages sends a request to url for crawling.
 // It crawls for each product contained in url which is the subcategory url.
+// Lazy-loaded images are resolved to the largest image of their srcset rather than their placeholder.
 // It returns a slice of ProductImage structures which contain the product name and product image url.
-func GetLVProductImages(url string) []ProductImage {
+func GetLVProductImages(ctx context.Context, url string) []ProductImage {
+	ctx, span := startSpan(ctx, "lvapi.GetLVProductImages", attribute.String("lv.url", url))
+	defer span.End()
 	// Slice to hold ProductImage structs
 	var productImages []ProductImage
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointProductImages)
 	// Find within the children of ul tag with class lv-list.
 	// Finds each .lv-product-card within the list
 	// Creates a ProductImage using the product name and the product image url into productPages productImages.
@@ -238,10 +278,10 @@ func GetLVProductImages(url string) []ProductImage {
 			p := strings.NewReader(s.Text())
 			productText, _ := goquery.NewDocumentFromReader(p)
 			productText.Find("img").Each(func(i int, el *goquery.Selection) {
-				productImageSrc, productImageSrcExists := el.Attr("src")
+				productImageSrc := imageSource(el)
 				el.Remove()
-				if productImageSrcExists {
-					productImage := ProductImage{name: strings.TrimSpace(productText.Text()), url: productImageSrc}
+				if productImageSrc != "" {
+					productImage := ProductImage{Name: strings.TrimSpace(productText.Text()), URL: e.Request.AbsoluteURL(productImageSrc)}
 					productImages = append(productImages, productImage)
 				}
 			})
@@ -249,18 +289,18 @@ func GetLVProductImages(url string) []ProductImage {
 	})
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
 	})
 	// Response Handler
 	c.OnResponse(func(r *colly.Response) {
 		//fmt.Println(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit(url)
+	visit(ctx, c, url)
 	return productImages
 }
 
@@ -269,20 +309,29 @@ func GetLVProductImages(url string) []ProductImage {
 // The response body should be a JSON string if the REST API was successfully loaded.
 // gocolly is used to extract the JSON from the REST API endpoint as access via HTTP requests is denied.
 // gocolly allows us to access the end point by randomizing our user agent.
-func getLVProductJSONBodyBySKU(sku string) string {
+// It returns ErrUnknownSKU instead if the endpoint answered 404, or an *UpstreamError if the
+// request failed otherwise.
+func getLVProductJSONBodyBySKU(ctx context.Context, sku string) (string, error) {
+	ctx, span := startSpan(ctx, "lvapi.getLVProductJSONBodyBySKU", attribute.String("lv.sku", sku))
+	defer span.End()
 	// REST API endpoint for LV SKU catalog
-	endpoint := "https://api.louisvuitton.com/api/eng-ca/catalog/skus/" + sku
+	endpoint := apiURL(DefaultRegion, "/catalog/skus/"+sku)
 	// JSON output
 	jsonString := ""
+	var fetchErr error
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointSKU)
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
 	})
 	// Response body contains the JSON string from API endpoint.
 	// Extract the JSON string for return
@@ -290,78 +339,101 @@ func getLVProductJSONBodyBySKU(sku string) string {
 		jsonString = string(r.Body)
 	})
 	// Send visit request to colly collector
-	c.Visit(endpoint)
-	return jsonString
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	return jsonString, fetchErr
 }
 
-// GetLVProductPageURLBySKU sends a request to getLVProductJSONBodyBySKU.
-// It retrieves a JSON string for the corresponding sku.
-// The JSON string is parsed and the product page URL is returned.
-func GetLVProductPageURLBySKU(sku string) string {
-	// Output URL
-	url := ""
-	// Call to retrieve JSON string from REST API endpoint
-	jsonString := getLVProductJSONBodyBySKU(sku)
-	// Checks if the JSON response has a list size of greater than zero to
-	// ensure that SKU is valid. If valid, then the JSON string is parsed
-	// and the product page URL is extracted from the JSON string.
-	// If invalid, then an error is returned.
-	if strings.Contains(jsonString, "\"skuListSize\":0") {
-		url = "Invalid SKU"
-	} else {
-		var result map[string]interface{}
-		json.Unmarshal([]byte(jsonString), &result)
-		for _, item := range result["skuList"].([]interface{}) {
-			url = fmt.Sprintf("%v", item.(map[string]interface{})["url"])
+// GetLVProductPageURLBySKU returns the product page URL of sku as listed by the SKU catalog,
+// in the DefaultRegion store. GetLVProductPagesBySKU returns every entry with its URL in each region.
+// It returns the errors of GetLVProductPagesBySKU, and ErrUnknownSKU if no entry has a product page.
+func GetLVProductPageURLBySKU(ctx context.Context, sku string) (string, error) {
+	pages, err := GetLVProductPagesBySKU(ctx, sku, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, page := range pages {
+		if page.Sku == sku {
+			return page.ListedURL, nil
+		}
+	}
+	if len(pages) == 0 {
+		return "", ErrUnknownSKU
+	}
+	return pages[len(pages)-1].ListedURL, nil
+}
+
+// parseLVProductOffer extracts the price and currency from the offers of a product model item.
+// offers may be a single offer object or a list of offers, in which case the first priced offer is used.
+// Returns a zero price and empty currency if no offer is listed.
+func parseLVProductOffer(item map[string]interface{}) (float64, string) {
+	offers, ok := item["offers"].([]interface{})
+	if !ok {
+		offers = []interface{}{item["offers"]}
+	}
+	for _, o := range offers {
+		offer, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		price := parseLVPrice(offer["price"])
+		if price > 0 {
+			return price, fmt.Sprintf("%v", offer["priceCurrency"])
 		}
 	}
-	return url
+	return 0, ""
 }
 
-// getNextMapLevelDown checks rec for key, and returns the value of key in rec.
-// Returns a reflect.Zero value if rec is not a Map or if key is not found
-func getNextMapLevelDown(rec reflect.Value, key string) reflect.Value {
-	if rec.Kind() == reflect.Map {
-		for _, k := range rec.MapKeys() {
-			v := rec.MapIndex(k)
-			if k.Interface() == key {
-				return reflect.ValueOf(v.Interface())
+// parseLVPrice converts a price value from the product JSON into a float.
+// The value may be a JSON number or a formatted string such as "2,210.00" or "1.650,00 €".
+// Returns zero if the value cannot be parsed.
+func parseLVPrice(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case string:
+		// Keep only digits and separators
+		digits := strings.Map(func(r rune) rune {
+			if (r >= '0' && r <= '9') || r == '.' || r == ',' {
+				return r
 			}
+			return -1
+		}, v)
+		// The last separator is the decimal separator when followed by exactly two digits,
+		// every other separator groups thousands.
+		decimal := strings.LastIndexAny(digits, ".,")
+		if decimal >= 0 && len(digits)-decimal-1 == 2 {
+			digits = strings.NewReplacer(".", "", ",", "").Replace(digits[:decimal]) + "." + digits[decimal+1:]
+		} else {
+			digits = strings.NewReplacer(".", "", ",", "").Replace(digits)
+		}
+		price, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return 0
 		}
+		return price
 	}
-	return reflect.Zero(reflect.TypeOf(0))
+	return 0
 }
 
-// GetLVProductPageAPIEndPointBySKU sends a request to getLVProductJSONBodyBySKU.
-// It retrieves a JSON string for the corresponding sku.
-// The JSON string is parsed and the product API endpoint is returned.
-func GetLVProductPageAPIEndPointBySKU(sku string) string {
-	// Output endpoint
+// GetLVProductPageAPIEndPointBySKU sends a request to GetLVSKUResource.
+// The product API endpoint is the self link of the last skuList entry of the response.
+// It returns "Invalid SKU" if the catalog does not list sku, or an empty string if the
+// request failed or the entry has no self link.
+func GetLVProductPageAPIEndPointBySKU(ctx context.Context, sku string) string {
+	resource, err := GetLVSKUResource(ctx, sku)
+	if errors.Is(err, ErrUnknownSKU) || errors.Is(err, ErrInvalidSKU) {
+		return "Invalid SKU"
+	}
+	if err != nil {
+		return ""
+	}
+	entries, _ := resource.List("skuList")
 	endpoint := ""
-	// Call to retrieve JSON string from REST API endpoint
-	jsonString := getLVProductJSONBodyBySKU(sku)
-	// Checks if the JSON response has a list size of greater than zero to
-	// ensure that SKU is valid. If valid, then the JSON string is parsed
-	// and the product page API endpoint is extracted from the JSON string.
-	// If invalid, then an error is returned.
-	if strings.Contains(jsonString, "\"skuListSize\":0") {
-		endpoint = "Invalid SKU"
-	} else {
-		var result map[string]interface{}
-		json.Unmarshal([]byte(jsonString), &result)
-		for _, item := range result["skuList"].([]interface{}) {
-			if rec, ok := item.(map[string]interface{}); ok {
-				for key, val := range rec {
-					if key == "_links" {
-						v := reflect.ValueOf(val)
-						selfMap := getNextMapLevelDown(v, "self")
-						if selfMap.IsValid() {
-							hrefMap := getNextMapLevelDown(selfMap, "href")
-							endpoint = fmt.Sprintf("%v", hrefMap)
-						}
-					}
-				}
-			}
+	for _, entry := range entries {
+		if href, err := entry.Href("self", nil); err == nil {
+			endpoint = href
 		}
 	}
 	return endpoint
@@ -375,33 +447,76 @@ func GetLVProductPageAPIEndPointBySKU(sku string) string {
 // It returns true if the product sku is available, false if not.
 // gocolly is used to extract the JSON from the REST API endpoint as access via HTTP requests is denied.
 // gocolly allows us to access the end point by randomizing our user agent.
-func GetLVProductAvailabilityBySKU(sku string) ProductAvailability {
+func GetLVProductAvailabilityBySKU(ctx context.Context, sku string) ProductAvailability {
+	return GetLVProductAvailabilityBySKUInRegion(ctx, sku, DefaultRegion)
+}
+
+// GetLVProductAvailabilityBySKUInRegion sends a request to the product API page for sku in region:
+// 		'https://api.louisvuitton.com/api/region/catalog/product/sku'
+// It extracts availability and price the same way as GetLVProductAvailabilityBySKU,
+// with the price listed in the currency of region.
+func GetLVProductAvailabilityBySKUInRegion(ctx context.Context, sku string, region string) ProductAvailability {
+	product, _ := FetchLVProductAvailability(ctx, sku, region)
+	return product
+}
+
+// FetchLVProductAvailability sends a request to the product API page for sku in region:
+// 		'https://api.louisvuitton.com/api/region/catalog/product/sku'
+// It extracts availability and price the same way as GetLVProductAvailabilityBySKUInRegion.
+// It returns ErrInvalidSKU without sending a request if sku is malformed, ErrUnknownSKU if the
+// product API does not list sku, an *UpstreamError if the request failed, or
+// ErrUnexpectedResponse if the response could not be parsed.
+func FetchLVProductAvailability(ctx context.Context, sku string, region string) (ProductAvailability, error) {
+	ctx, span := startSpan(ctx, "lvapi.FetchLVProductAvailability", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return ProductAvailability{Sku: sku}, err
+	}
 	// REST API endpoint for LV SKU catalog
-	endpoint := "https://api.louisvuitton.com/api/eng-ca/catalog/product/" + sku
+	endpoint := apiURL(region, "/catalog/product/"+sku)
 	isProductAvailable := false
+	price := 0.0
+	currency := ""
+	var fetchErr error
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointProduct)
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
 	})
 	// Response body contains the JSON string from API endpoint.
 	// Parse the JSON string from the response to extract the backOrderDisclaimer.
 	// There may be multiple backOrderDisclaimer fields depending on if there is
 	// related skus to the search sku. Match backOrderDisclaimer using identifier.
 	c.OnResponse(func(r *colly.Response) {
+		_, parseSpan := startSpan(ctx, "lvapi.parseProductJSON")
+		defer parseSpan.End()
 		jsonString := string(r.Body)
 		if strings.Contains(jsonString, "errorCode") {
 			isProductAvailable = false
+			fetchErr = ErrUnknownSKU
 		} else {
 			var result map[string]interface{}
 			json.Unmarshal([]byte(jsonString), &result)
-			for _, item := range result["model"].([]interface{}) {
+			models, ok := result["model"].([]interface{})
+			if !ok {
+				fetchErr = ErrUnexpectedResponse
+				observeParseFailure(EndpointProduct)
+				return
+			}
+			fetchErr = ErrUnknownSKU
+			for _, item := range models {
 				if item.(map[string]interface{})["identifier"] == sku {
+					fetchErr = nil
+					price, currency = parseLVProductOffer(item.(map[string]interface{}))
 					propertyMapSlice := reflect.ValueOf(item.(map[string]interface{})["additionalProperty"])
 					if propertyMapSlice.Kind() == reflect.Slice {
 						for i := 0; i < propertyMapSlice.Len(); i++ {
@@ -417,68 +532,107 @@ func GetLVProductAvailabilityBySKU(sku string) ProductAvailability {
 		}
 	})
 	// Send visit request to colly collector
-	c.Visit(endpoint)
-	return ProductAvailability{Sku: sku, Available: isProductAvailable}
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	return ProductAvailability{Sku: sku, Available: isProductAvailable, Price: price, Currency: currency}, fetchErr
 }
 
-// GetLVAlternativeStyleProductIndentifierAndAvailabilityForSKU sends a request to the product API page for sku:
-// 		'https://api.louisvuitton.com/api/eng-ca/catalog/product/sku'
+// FetchLVAlternativeStyleAvailability sends a request to the product API page for sku in region:
+// 		'https://api.louisvuitton.com/api/region/catalog/product/sku'
 // It crawls and retrieves the JSON string from the endpoint.
 // The JSON string is parsed into a map, and then proccessed to extract availability
 // for sku based on the value of backOrderDisclaimer for the sku. Then searches the rest of the JSON,
 // if there is alternative styles for their backOrderDisclaimer and their sku.
 // It returns a slice of structs each containing a sku number, and the availability.
-// gocolly is used to extract the JSON from the REST API endpoint as access via HTTP requests is denied.
-// gocolly allows us to access the end point by randomizing our user agent.
-func GetLVAlternativeStyleProductIndentifierAndAvailabilityForSKU(sku string) []ProductAvailability {
+// It returns ErrInvalidSKU without sending a request if sku is malformed, ErrUnknownSKU if the
+// product API does not list sku, an *UpstreamError if the request failed, or
+// ErrUnexpectedResponse if the response could not be parsed.
+func FetchLVAlternativeStyleAvailability(ctx context.Context, sku string, region string) ([]ProductAvailability, error) {
+	ctx, span := startSpan(ctx, "lvapi.FetchLVAlternativeStyleAvailability", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return nil, err
+	}
 	// Output slice
 	var productAvailabilitySlice []ProductAvailability
+	var fetchErr error
 	// REST API endpoint for LV SKU catalog
-	endpoint := "https://api.louisvuitton.com/api/eng-ca/catalog/product/" + sku
+	endpoint := apiURL(region, "/catalog/product/"+sku)
 	// Init colly collector
-	c := createCollyCollector()
+	c := createCollyCollector(ctx, EndpointProduct)
 	// Request Handler
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		Debug(ctx, "visiting", F("url", r.URL.String()))
 	})
 	// Error Handler
 	c.OnError(func(r *colly.Response, err error) {
-		log.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
 	})
 	// Response body contains the JSON string from API endpoint.
 	// Parse the JSON string from the response to extract the backOrderDisclaimer.
 	// There may be multiple backOrderDisclaimer fields depending on if there is
 	// related skus to the search sku. Create a ProductAvailability struct for each product
 	c.OnResponse(func(r *colly.Response) {
+		_, parseSpan := startSpan(ctx, "lvapi.parseProductJSON")
+		defer parseSpan.End()
 		jsonString := string(r.Body)
 		if strings.Contains(jsonString, "errorCode") {
-			productAvailabilitySlice = nil
-		} else {
-			var result map[string]interface{}
-			json.Unmarshal([]byte(jsonString), &result)
-			for _, item := range result["model"].([]interface{}) {
-				identifier := item.(map[string]interface{})["identifier"]
-				if identifier != nil {
-					propertyMapSlice := reflect.ValueOf(item.(map[string]interface{})["additionalProperty"])
-					if propertyMapSlice.Kind() == reflect.Slice {
-						for i := 0; i < propertyMapSlice.Len(); i++ {
-							propertyMap := reflect.ValueOf(propertyMapSlice.Index(i))
-							if strings.Contains(fmt.Sprintf("%v", propertyMap.Interface()), "name:backOrderDisclaimer value:false") {
-								product := ProductAvailability{Sku: fmt.Sprintf("%v", identifier), Available: true}
-								productAvailabilitySlice = append(productAvailabilitySlice, product)
-								break
-							} else if strings.Contains(fmt.Sprintf("%v", propertyMap.Interface()), "name:backOrderDisclaimer value:true") {
-								product := ProductAvailability{Sku: fmt.Sprintf("%v", identifier), Available: false}
-								productAvailabilitySlice = append(productAvailabilitySlice, product)
-								break
-							}
-						}
+			fetchErr = ErrUnknownSKU
+			return
+		}
+		var result map[string]interface{}
+		json.Unmarshal([]byte(jsonString), &result)
+		models, ok := result["model"].([]interface{})
+		if !ok {
+			fetchErr = ErrUnexpectedResponse
+			observeParseFailure(EndpointProduct)
+			return
+		}
+		for _, m := range models {
+			item, ok := m.(map[string]interface{})
+			if !ok || item["identifier"] == nil {
+				continue
+			}
+			identifier := item["identifier"]
+			price, currency := parseLVProductOffer(item)
+			propertyMapSlice := reflect.ValueOf(item["additionalProperty"])
+			if propertyMapSlice.Kind() == reflect.Slice {
+				for i := 0; i < propertyMapSlice.Len(); i++ {
+					propertyMap := reflect.ValueOf(propertyMapSlice.Index(i))
+					if strings.Contains(fmt.Sprintf("%v", propertyMap.Interface()), "name:backOrderDisclaimer value:false") {
+						product := ProductAvailability{Sku: fmt.Sprintf("%v", identifier), Available: true, Price: price, Currency: currency}
+						productAvailabilitySlice = append(productAvailabilitySlice, product)
+						break
+					} else if strings.Contains(fmt.Sprintf("%v", propertyMap.Interface()), "name:backOrderDisclaimer value:true") {
+						product := ProductAvailability{Sku: fmt.Sprintf("%v", identifier), Available: false, Price: price, Currency: currency}
+						productAvailabilitySlice = append(productAvailabilitySlice, product)
+						break
 					}
 				}
 			}
 		}
 	})
 	// Send visit request to colly collector
-	c.Visit(endpoint)
-	return productAvailabilitySlice
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return productAvailabilitySlice, nil
+}
+
+// GetLVAlternativeStyleProductIndentifierAndAvailabilityForSKU returns the availability of sku and
+// its alternative styles in DefaultRegion the same way as FetchLVAlternativeStyleAvailability.
+// It returns nil if the product could not be found.
+// gocolly is used to extract the JSON from the REST API endpoint as access via HTTP requests is denied.
+// gocolly allows us to access the end point by randomizing our user agent.
+func GetLVAlternativeStyleProductIndentifierAndAvailabilityForSKU(ctx context.Context, sku string) []ProductAvailability {
+	products, _ := FetchLVAlternativeStyleAvailability(ctx, sku, DefaultRegion)
+	return products
 }
@@ -0,0 +1,123 @@
+package lvapi
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Endpoint types reported to the Observer
+const (
+	EndpointRegions       = "regions"
+	EndpointCategories    = "categories"
+	EndpointSubcategories = "subcategories"
+	EndpointProductRoutes = "product_routes"
+	EndpointProductImages = "product_images"
+	EndpointSKU           = "sku"
+	EndpointProduct       = "product"
+	EndpointStores        = "stores"
+	EndpointStoreStock    = "store_stock"
+	EndpointPing          = "ping"
+	EndpointLink          = "link"
+	EndpointImage         = "image"
+)
+
+// An Observer is notified of every request lvapi makes to an LV endpoint, so callers can
+// export metrics without lvapi depending on a metrics library. Implementations must be safe
+// for concurrent use.
+type Observer interface {
+	// ObserveRequest is called once a request to endpoint in region has completed.
+	// status is the HTTP status code, zero if no response was received.
+	ObserveRequest(endpoint string, region string, status int, duration time.Duration)
+	// ObserveParseFailure is called when a response from endpoint cannot be parsed.
+	ObserveParseFailure(endpoint string)
+}
+
+// nopObserver discards every observation.
+type nopObserver struct{}
+
+func (nopObserver) ObserveRequest(string, string, int, time.Duration) {}
+func (nopObserver) ObserveParseFailure(string)                        {}
+
+// Observer notified of lvapi requests, discarding everything by default
+var (
+	observerMu sync.RWMutex
+	observer   Observer = nopObserver{}
+)
+
+// SetObserver replaces the Observer notified of lvapi requests.
+func SetObserver(o Observer) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	observer = o
+}
+
+// currentObserver returns the Observer set by SetObserver.
+func currentObserver() Observer {
+	observerMu.RLock()
+	defer observerMu.RUnlock()
+	return observer
+}
+
+// observeParseFailure reports a response from endpoint that could not be parsed.
+func observeParseFailure(endpoint string) {
+	currentObserver().ObserveParseFailure(endpoint)
+}
+
+// Region codes listed on the LV landing page by GetLVRegionCodesAndURLs
+var (
+	listedRegionsMu sync.RWMutex
+	listedRegions   = map[string]bool{DefaultRegion: true}
+)
+
+// listRegions adds the codes of regions to the regions listed on the LV landing page.
+func listRegions(regions []RegionURL) {
+	listedRegionsMu.Lock()
+	defer listedRegionsMu.Unlock()
+	for _, region := range regions {
+		listedRegions[region.Code] = true
+	}
+}
+
+// ListedRegion returns whether region is DefaultRegion or was listed on the LV landing page by
+// GetLVRegionCodesAndURLs, so an Observer can tell real regions from ones made up by its callers.
+func ListedRegion(region string) bool {
+	listedRegionsMu.RLock()
+	defer listedRegionsMu.RUnlock()
+	return listedRegions[region]
+}
+
+// Matches a region code such as eng-ca in a URL path
+var regionPattern = regexp.MustCompile(`^[a-z]{3}-[a-z0-9]{2}$`)
+
+// regionFromURL returns the region code in the path of u, or an empty string if there is none.
+func regionFromURL(u *url.URL) string {
+	for _, segment := range strings.Split(u.Path, "/") {
+		if regionPattern.MatchString(segment) {
+			return segment
+		}
+	}
+	return ""
+}
+
+// observeCollector reports every request made by c to endpoint to the Observer.
+func observeCollector(c *colly.Collector, endpoint string) {
+	c.OnRequest(func(r *colly.Request) {
+		r.Ctx.Put("start", time.Now())
+	})
+	observe := func(r *colly.Response) {
+		start, ok := r.Ctx.GetAny("start").(time.Time)
+		if !ok {
+			return
+		}
+		currentObserver().ObserveRequest(endpoint, regionFromURL(r.Request.URL), r.StatusCode, time.Since(start))
+	}
+	c.OnResponse(observe)
+	c.OnError(func(r *colly.Response, err error) {
+		observe(r)
+	})
+}
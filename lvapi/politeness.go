@@ -0,0 +1,52 @@
+package lvapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Politeness limit shared by every request lvapi crawls
+var (
+	politenessMu    sync.Mutex
+	requestInterval time.Duration
+	nextRequest     time.Time
+)
+
+// SetRequestInterval sets the minimum time between the starts of any two requests lvapi sends
+// to LV endpoints, across every caller and goroutine, so crawling stays polite however many
+// watchers and handlers run at once. Zero, the default, disables the limit.
+// PingUpstream is not limited so health checks don't queue behind crawls.
+func SetRequestInterval(interval time.Duration) {
+	politenessMu.Lock()
+	defer politenessMu.Unlock()
+	requestInterval = interval
+}
+
+// waitForTurn reserves the next request slot and blocks until it starts.
+// It returns ctx.Err() if ctx is done first.
+func waitForTurn(ctx context.Context) error {
+	politenessMu.Lock()
+	if requestInterval <= 0 {
+		politenessMu.Unlock()
+		return nil
+	}
+	start := time.Now()
+	if nextRequest.After(start) {
+		start = nextRequest
+	}
+	nextRequest = start.Add(requestInterval)
+	politenessMu.Unlock()
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
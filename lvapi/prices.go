@@ -0,0 +1,166 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Number of regions fetched at the same time when comparing prices
+const regionFetchConcurrency = 4
+
+// Countries whose listed prices exclude sales tax. Prices in every other country include VAT.
+var vatExclusiveCountries = map[string]bool{
+	"us": true,
+	"ca": true,
+}
+
+// An ExchangeRates represents an exchange rate table loaded from a local JSON file:
+//
+//	{"Base": "EUR", "Rates": {"USD": 1.08, "CAD": 1.47}, "VAT": {"fr": 20, "gb": 20}}
+//
+// Each rate is the amount of the currency worth one unit of Base.
+// VAT holds the VAT percentage keyed by country code, used to compute prices excluding VAT.
+type ExchangeRates struct {
+	Base  string             `json:"Base"`  // Currency code the rates are relative to
+	Rates map[string]float64 `json:"Rates"` // Exchange rates keyed by currency code
+	VAT   map[string]float64 `json:"VAT"`   // VAT percentages keyed by country code
+}
+
+// A RegionalPrice represents the price of a product sku in a region converted into a base currency.
+type RegionalPrice struct {
+	Sku                   string  `json:"Sku"`                   // Product identifier
+	Region                string  `json:"Region"`                // Region code
+	Available             bool    `json:"Available"`             // Product availability in region
+	Price                 float64 `json:"Price"`                 // Price listed in region
+	Currency              string  `json:"Currency"`              // Currency code of the listed price
+	BaseCurrency          string  `json:"BaseCurrency"`          // Currency code prices are converted to
+	BasePrice             float64 `json:"BasePrice"`             // Listed price converted to BaseCurrency
+	BasePriceExcludingVAT float64 `json:"BasePriceExcludingVAT"` // BasePrice with the region VAT removed
+	VATIncluded           bool    `json:"VATIncluded"`           // Listed price includes VAT
+	VATExcluded           bool    `json:"VATExcluded"`           // Listed price excludes sales tax
+	VATUnknown            bool    `json:"VATUnknown"`            // VAT rate of the region is missing from the exchange rates, BasePriceExcludingVAT is BasePrice
+}
+
+// LoadExchangeRates reads an exchange rate table from the JSON file at path.
+// It returns the loaded ExchangeRates or an error if the file cannot be read or parsed.
+func LoadExchangeRates(path string) (ExchangeRates, error) {
+	var rates ExchangeRates
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return rates, err
+	}
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return rates, fmt.Errorf("parsing exchange rates %s: %v", path, err)
+	}
+	if rates.Base == "" {
+		return rates, fmt.Errorf("parsing exchange rates %s: missing Base currency", path)
+	}
+	return rates, nil
+}
+
+// Convert converts amount from currency from into currency to.
+// It returns false if either currency is missing from the table.
+func (e ExchangeRates) Convert(amount float64, from string, to string) (float64, bool) {
+	fromRate, fromFound := e.rate(from)
+	toRate, toFound := e.rate(to)
+	if !fromFound || !toFound {
+		return 0, false
+	}
+	return amount / fromRate * toRate, true
+}
+
+// rate returns the exchange rate of currency relative to the base currency.
+func (e ExchangeRates) rate(currency string) (float64, bool) {
+	currency = strings.ToUpper(currency)
+	if currency == strings.ToUpper(e.Base) {
+		return 1, true
+	}
+	rate, found := e.Rates[currency]
+	return rate, found && rate > 0
+}
+
+// regionCountry returns the country code of a region code such as "eng-ca".
+func regionCountry(region string) string {
+	parts := strings.Split(region, "-")
+	return strings.ToLower(parts[len(parts)-1])
+}
+
+// CompareLVProductPricesAcrossRegions fetches the price of sku in every region from GetLVRegionCodesAndURLs.
+// Each price is converted into baseCurrency using rates.
+// Regions where the sku is not listed, or whose currency is missing from rates, are left out.
+// It returns the regional prices ranked from cheapest to most expensive, comparing prices
+// excluding VAT if excludeVAT is set. Prices with VATUnknown set are then ranked last.
+func CompareLVProductPricesAcrossRegions(ctx context.Context, sku string, baseCurrency string, rates ExchangeRates, excludeVAT bool) []RegionalPrice {
+	ctx, span := startSpan(ctx, "lvapi.CompareLVProductPricesAcrossRegions", attribute.String("lv.sku", sku))
+	defer span.End()
+	// Region codes may be listed more than once on the landing page
+	var regions []string
+	seen := make(map[string]bool)
+	for _, region := range GetLVRegionCodesAndURLs(ctx) {
+		if !seen[region.Code] {
+			seen[region.Code] = true
+			regions = append(regions, region.Code)
+		}
+	}
+	// Fetch regions concurrently, bounded to regionFetchConcurrency requests at a time
+	var prices []RegionalPrice
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, regionFetchConcurrency)
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			product := GetLVProductAvailabilityBySKUInRegion(ctx, sku, region)
+			if product.Price <= 0 {
+				return
+			}
+			basePrice, ok := rates.Convert(product.Price, product.Currency, baseCurrency)
+			if !ok {
+				Warn(ctx, "no exchange rate", F("currency", product.Currency), F("region", region))
+				return
+			}
+			price := RegionalPrice{
+				Sku:          sku,
+				Region:       region,
+				Available:    product.Available,
+				Price:        product.Price,
+				Currency:     product.Currency,
+				BaseCurrency: strings.ToUpper(baseCurrency),
+				BasePrice:    basePrice,
+				VATIncluded:  !vatExclusiveCountries[regionCountry(region)],
+			}
+			price.VATExcluded = !price.VATIncluded
+			price.BasePriceExcludingVAT = basePrice
+			if price.VATIncluded {
+				vat, found := rates.VAT[regionCountry(region)]
+				price.VATUnknown = !found
+				price.BasePriceExcludingVAT = basePrice / (1 + vat/100)
+			}
+			mu.Lock()
+			prices = append(prices, price)
+			mu.Unlock()
+		}(region)
+	}
+	wg.Wait()
+	// Rank by cheapest, prices whose VAT is unknown can't be compared without VAT so they come last
+	sort.Slice(prices, func(i, j int) bool {
+		if excludeVAT {
+			if prices[i].VATUnknown != prices[j].VATUnknown {
+				return prices[j].VATUnknown
+			}
+			return prices[i].BasePriceExcludingVAT < prices[j].BasePriceExcludingVAT
+		}
+		return prices[i].BasePrice < prices[j].BasePrice
+	})
+	return prices
+}
@@ -0,0 +1,250 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A Store represents a Louis Vuitton boutique returned by the store locator.
+type Store struct {
+	ID        string  `json:"ID"`        // Store identifier
+	Name      string  `json:"Name"`      // Store name
+	Address   string  `json:"Address"`   // Street address
+	City      string  `json:"City"`      // City
+	Country   string  `json:"Country"`   // Country
+	Latitude  float64 `json:"Latitude"`  // Store latitude
+	Longitude float64 `json:"Longitude"` // Store longitude
+	Distance  float64 `json:"Distance"`  // Distance from the searched location in km, zero for city searches
+}
+
+// A StoreAvailability represents the in-store availability of a product sku at a Store.
+type StoreAvailability struct {
+	Store
+	Sku       string `json:"Sku"`       // Product identifier
+	Available bool   `json:"Available"` // Product availability in store
+}
+
+// lvJSONString returns the first non-empty value of m found under any of keys as a string.
+func lvJSONString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, found := m[key]; found && value != nil {
+			if s := strings.TrimSpace(fmt.Sprintf("%v", value)); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// lvJSONFloat returns the first value of m found under any of keys as a float.
+// Numbers encoded as strings are parsed. Returns zero if none is found.
+func lvJSONFloat(m map[string]interface{}, keys ...string) float64 {
+	for _, key := range keys {
+		switch value := m[key].(type) {
+		case float64:
+			return value
+		case string:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f
+			}
+		}
+	}
+	return 0
+}
+
+// lvJSONList returns the list held by a JSON response, which may be the response itself
+// or a field of the response under any of keys.
+func lvJSONList(body []byte, keys ...string) []interface{} {
+	var list []interface{}
+	if err := json.Unmarshal(body, &list); err == nil {
+		return list
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil
+	}
+	for _, key := range keys {
+		if list, ok := result[key].([]interface{}); ok {
+			return list
+		}
+	}
+	return nil
+}
+
+// Mean radius of the earth in km
+const earthRadius = 6371.0
+
+// haversineDistance returns the great-circle distance in km between two coordinates in degrees.
+func haversineDistance(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLatitude := toRadians(latitude2 - latitude1)
+	dLongitude := toRadians(longitude2 - longitude1)
+	a := math.Sin(dLatitude/2)*math.Sin(dLatitude/2) +
+		math.Cos(toRadians(latitude1))*math.Cos(toRadians(latitude2))*math.Sin(dLongitude/2)*math.Sin(dLongitude/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// getLVStores sends a request to the store locator endpoint for region with query.
+// It crawls the REST API endpoint and parses each store in the response into a Store.
+// It returns a slice of Store structs, an *UpstreamError if the request failed, or one wrapping
+// a *CircuitOpenError without sending it while the circuit breaker is open.
+func getLVStores(ctx context.Context, region string, query url.Values) ([]Store, error) {
+	ctx, span := startSpan(ctx, "lvapi.getLVStores", attribute.String("lv.region", region))
+	defer span.End()
+	// Output slice
+	var stores []Store
+	var fetchErr error
+	// REST API endpoint for the LV store locator
+	endpoint := apiURL(region, "/stores?"+query.Encode())
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointStores)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+	})
+	// Response body contains the JSON list of stores.
+	c.OnResponse(func(r *colly.Response) {
+		for _, s := range lvJSONList(r.Body, "stores", "results", "hits") {
+			store, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id := lvJSONString(store, "storeId", "id", "identifier")
+			if id == "" {
+				continue
+			}
+			stores = append(stores, Store{
+				ID:        id,
+				Name:      lvJSONString(store, "name", "storeName"),
+				Address:   lvJSONString(store, "street", "address", "streetAddress"),
+				City:      lvJSONString(store, "city", "addressLocality"),
+				Country:   lvJSONString(store, "country", "countryCode", "addressCountry"),
+				Latitude:  lvJSONFloat(store, "latitude", "lat"),
+				Longitude: lvJSONFloat(store, "longitude", "lng"),
+				Distance:  lvJSONFloat(store, "distance"),
+			})
+		}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return stores, nil
+}
+
+// GetLVStoresNear sends a request to the store locator for the stores of region closest to latitude and longitude.
+// Stores the response gives no distance for are given their great-circle distance from the location.
+// It returns a slice of Store structs ordered by distance, or the errors of getLVStores.
+func GetLVStoresNear(ctx context.Context, latitude float64, longitude float64, region string) ([]Store, error) {
+	query := url.Values{}
+	query.Set("latitude", strconv.FormatFloat(latitude, 'f', -1, 64))
+	query.Set("longitude", strconv.FormatFloat(longitude, 'f', -1, 64))
+	stores, err := getLVStores(ctx, region, query)
+	if err != nil {
+		return nil, err
+	}
+	for i, store := range stores {
+		if store.Distance == 0 && (store.Latitude != 0 || store.Longitude != 0) {
+			stores[i].Distance = haversineDistance(latitude, longitude, store.Latitude, store.Longitude)
+		}
+	}
+	sort.SliceStable(stores, func(i, j int) bool { return stores[i].Distance < stores[j].Distance })
+	return stores, nil
+}
+
+// GetLVStoresInCity sends a request to the store locator for the stores of region in city.
+// It returns a slice of Store structs, or the errors of getLVStores.
+func GetLVStoresInCity(ctx context.Context, city string, region string) ([]Store, error) {
+	query := url.Values{}
+	query.Set("city", city)
+	return getLVStores(ctx, region, query)
+}
+
+// GetLVStoreAvailabilityBySKU sends a request to the in-store stock endpoint for sku in region:
+//
+//	'https://api.louisvuitton.com/api/region/catalog/availability/sku?storeIds=...'
+//
+// It crawls the REST API endpoint and matches each stock level in the response to one of stores.
+// It returns a slice of StoreAvailability structs, one for each of stores. It returns ErrInvalidSKU
+// without sending a request if sku is malformed, ErrUnknownSKU if the endpoint does not know sku,
+// an *UpstreamError if the request failed, or one wrapping a *CircuitOpenError without sending
+// it while the circuit breaker is open.
+func GetLVStoreAvailabilityBySKU(ctx context.Context, sku string, region string, stores []Store) ([]StoreAvailability, error) {
+	ctx, span := startSpan(ctx, "lvapi.GetLVStoreAvailabilityBySKU", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return nil, err
+	}
+	// Output slice, stores missing from the response are reported as unavailable
+	availability := make([]StoreAvailability, len(stores))
+	storeIndex := make(map[string]int)
+	storeIDs := make([]string, len(stores))
+	for i, store := range stores {
+		availability[i] = StoreAvailability{Store: store, Sku: sku}
+		storeIndex[store.ID] = i
+		storeIDs[i] = store.ID
+	}
+	if len(stores) == 0 {
+		return availability, nil
+	}
+	var fetchErr error
+	// REST API endpoint for LV in-store stock
+	endpoint := apiURL(region, "/catalog/availability/"+sku) +
+		"?storeIds=" + url.QueryEscape(strings.Join(storeIDs, ","))
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointStoreStock)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
+	})
+	// Response body contains the JSON list of stock levels by store.
+	// A store has the sku when it is flagged in stock or reports a positive stock level.
+	c.OnResponse(func(r *colly.Response) {
+		for _, s := range lvJSONList(r.Body, "stores", "stockLevels", "skuAvailability") {
+			stock, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			i, found := storeIndex[lvJSONString(stock, "storeId", "id")]
+			if !found {
+				continue
+			}
+			inStock := lvJSONString(stock, "inStock", "available")
+			availability[i].Available = inStock == "true" || lvJSONFloat(stock, "stockLevel", "quantity") > 0
+		}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return availability, nil
+}
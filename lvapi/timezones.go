@@ -0,0 +1,66 @@
+package lvapi
+
+import (
+	"strings"
+	"time"
+)
+
+// IANA time zones of the stores keyed by the country part of region codes. Countries spanning
+// several time zones use the zone of their main LV stores.
+var regionTimeZones = map[string]string{
+	"ae": "Asia/Dubai",
+	"at": "Europe/Vienna",
+	"au": "Australia/Sydney",
+	"be": "Europe/Brussels",
+	"br": "America/Sao_Paulo",
+	"ca": "America/Toronto",
+	"ch": "Europe/Zurich",
+	"cn": "Asia/Shanghai",
+	"de": "Europe/Berlin",
+	"dk": "Europe/Copenhagen",
+	"e1": "Europe/Paris",
+	"es": "Europe/Madrid",
+	"fi": "Europe/Helsinki",
+	"fr": "Europe/Paris",
+	"gb": "Europe/London",
+	"hk": "Asia/Hong_Kong",
+	"ie": "Europe/Dublin",
+	"in": "Asia/Kolkata",
+	"it": "Europe/Rome",
+	"jp": "Asia/Tokyo",
+	"kr": "Asia/Seoul",
+	"kw": "Asia/Kuwait",
+	"lu": "Europe/Luxembourg",
+	"mc": "Europe/Monaco",
+	"mx": "America/Mexico_City",
+	"my": "Asia/Kuala_Lumpur",
+	"nl": "Europe/Amsterdam",
+	"nz": "Pacific/Auckland",
+	"qa": "Asia/Qatar",
+	"ru": "Europe/Moscow",
+	"sa": "Asia/Riyadh",
+	"se": "Europe/Stockholm",
+	"sg": "Asia/Singapore",
+	"th": "Asia/Bangkok",
+	"tw": "Asia/Taipei",
+	"uk": "Europe/London",
+	"us": "America/New_York",
+}
+
+// RegionLocation returns the time zone of the stores of region, such as America/Toronto for
+// eng-ca. It returns UTC if the region is unknown or its time zone database entry is missing.
+func RegionLocation(region string) *time.Location {
+	country := region
+	if dash := strings.LastIndex(region, "-"); dash >= 0 {
+		country = region[dash+1:]
+	}
+	name, found := regionTimeZones[strings.ToLower(country)]
+	if !found {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
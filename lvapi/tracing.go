@@ -0,0 +1,55 @@
+package lvapi
+
+import (
+	"context"
+
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer lvapi spans are created with
+const tracerName = "example.com/lvapi"
+
+// startSpan starts a span named name as a child of the span in ctx, using the globally
+// registered tracer provider. Spans are dropped unless the caller has registered one.
+// It returns the context carrying the new span and the span, which the caller must end.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// traceCollector starts a client span for every request made by c to endpoint,
+// as a child of the span in ctx, and ends it once the response or error is received.
+// Trace context is not propagated upstream.
+func traceCollector(ctx context.Context, c *colly.Collector, endpoint string) {
+	c.OnRequest(func(r *colly.Request) {
+		_, span := otel.Tracer(tracerName).Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPURLKey.String(r.URL.String()),
+				attribute.String("lv.endpoint", endpoint),
+				attribute.String("lv.region", regionFromURL(r.URL)),
+			))
+		r.Ctx.Put("span", span)
+	})
+	c.OnResponse(func(r *colly.Response) {
+		if span, ok := r.Ctx.GetAny("span").(trace.Span); ok {
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.StatusCode))
+			span.End()
+		}
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if span, ok := r.Ctx.GetAny("span").(trace.Span); ok {
+			if r.StatusCode != 0 {
+				span.SetAttributes(semconv.HTTPStatusCodeKey.Int(r.StatusCode))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+		}
+	})
+}
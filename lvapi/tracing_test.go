@@ -0,0 +1,82 @@
+package lvapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Product API response of a single available product
+const productJSON = `{"model":[{"identifier":"M40995","offers":{"price":"2100","priceCurrency":"CAD"},
+	"additionalProperty":[{"name":"backOrderDisclaimer","value":false}]}]}`
+
+// spanNamed returns the first span of spans named name, failing t if there is none.
+func spanNamed(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return nil
+}
+
+// assertChild fails t unless child is a child of parent in the same trace.
+func assertChild(t *testing.T, parent sdktrace.ReadOnlySpan, child sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if child.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("span %q is in trace %s, want %s", child.Name(), child.SpanContext().TraceID(), parent.SpanContext().TraceID())
+	}
+	if child.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("parent of span %q is %s, want %q %s", child.Name(), child.Parent().SpanID(), parent.Name(), parent.SpanContext().SpanID())
+	}
+}
+
+func TestFetchLVProductAvailabilitySpans(t *testing.T) {
+	lv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/eng-ca/catalog/product/M40995" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(productJSON))
+	}))
+	defer lv.Close()
+	SetHosts(Hosts{API: lv.URL, Website: lv.URL})
+	defer SetHosts(DefaultHosts)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "caller")
+	product, err := FetchLVProductAvailability(ctx, "M40995", "eng-ca")
+	root.End()
+	if err != nil {
+		t.Fatalf("FetchLVProductAvailability: %v", err)
+	}
+	if !product.Available {
+		t.Errorf("product is not available")
+	}
+
+	spans := recorder.Ended()
+	caller := spanNamed(t, spans, "caller")
+	fetch := spanNamed(t, spans, "lvapi.FetchLVProductAvailability")
+	request := spanNamed(t, spans, "HTTP GET")
+	parse := spanNamed(t, spans, "lvapi.parseProductJSON")
+	assertChild(t, caller, fetch)
+	assertChild(t, fetch, request)
+	assertChild(t, fetch, parse)
+	if request.SpanKind() != trace.SpanKindClient {
+		t.Errorf("outbound span kind is %s, want client", request.SpanKind())
+	}
+}
@@ -0,0 +1,157 @@
+package lvapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gocolly/colly"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A ProductVariant represents one variant of a product model, such as a single shoe size,
+// belt length or color, with its own sku and online availability.
+type ProductVariant struct {
+	Sku       string  `json:"Sku"`       // Variant product identifier
+	Name      string  `json:"Name"`      // Variant product name
+	Color     string  `json:"Color"`     // Variant color or canvas, empty if not listed
+	Size      string  `json:"Size"`      // Variant size, empty if not listed
+	Length    string  `json:"Length"`    // Variant length, empty if not listed
+	Available bool    `json:"Available"` // Variant availability
+	Price     float64 `json:"Price"`     // Variant price, zero if not listed
+	Currency  string  `json:"Currency"`  // Variant price currency code
+}
+
+// lvProductProperties returns the additionalProperty name/value pairs of a product model item.
+// Names are lower cased so properties can be matched regardless of how they are capitalized.
+func lvProductProperties(item map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	list, _ := item["additionalProperty"].([]interface{})
+	for _, p := range list {
+		property, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := property["name"].(string); ok {
+			properties[strings.ToLower(name)] = property["value"]
+		}
+	}
+	return properties
+}
+
+// lvProductAttribute returns the first attribute of a product model item found under any of names,
+// looking at the item itself before its additionalProperty list. Returns an empty string if none is found.
+func lvProductAttribute(item map[string]interface{}, properties map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, found := item[name]; found && value != nil {
+			return strings.TrimSpace(fmt.Sprintf("%v", value))
+		}
+		if value, found := properties[strings.ToLower(name)]; found && value != nil {
+			return strings.TrimSpace(fmt.Sprintf("%v", value))
+		}
+	}
+	return ""
+}
+
+// parseLVProductVariant builds a ProductVariant from a product model item.
+// It returns false if the item has no identifier.
+func parseLVProductVariant(item map[string]interface{}) (ProductVariant, bool) {
+	identifier, found := item["identifier"]
+	if !found || identifier == nil {
+		return ProductVariant{}, false
+	}
+	properties := lvProductProperties(item)
+	variant := ProductVariant{
+		Sku:    fmt.Sprintf("%v", identifier),
+		Name:   lvProductAttribute(item, properties, "name"),
+		Color:  lvProductAttribute(item, properties, "color", "colour", "material"),
+		Size:   lvProductAttribute(item, properties, "size"),
+		Length: lvProductAttribute(item, properties, "length", "width"),
+	}
+	// A variant is available when its backOrderDisclaimer is false
+	if disclaimer, found := properties["backorderdisclaimer"]; found {
+		variant.Available = fmt.Sprintf("%v", disclaimer) == "false"
+	}
+	variant.Price, variant.Currency = parseLVProductOffer(item)
+	return variant, true
+}
+
+// FetchLVProductVariants sends a request to the product API page for sku in region:
+//
+//	'https://api.louisvuitton.com/api/region/catalog/product/sku'
+//
+// It crawls and retrieves the JSON string from the endpoint.
+// Every model in the JSON is parsed into a ProductVariant with its size, length and color
+// and its availability based on its own backOrderDisclaimer.
+// It returns a slice of ProductVariant structs. It returns ErrInvalidSKU without sending a request
+// if sku is malformed, ErrUnknownSKU if the product API does not list sku, an *UpstreamError if
+// the request failed, or ErrUnexpectedResponse if the response could not be parsed.
+func FetchLVProductVariants(ctx context.Context, sku string, region string) ([]ProductVariant, error) {
+	ctx, span := startSpan(ctx, "lvapi.FetchLVProductVariants", attribute.String("lv.sku", sku), attribute.String("lv.region", region))
+	defer span.End()
+	if err := ValidateSKU(sku); err != nil {
+		return nil, err
+	}
+	// Output slice
+	var variants []ProductVariant
+	var fetchErr error
+	// REST API endpoint for LV SKU catalog
+	endpoint := apiURL(region, "/catalog/product/"+sku)
+	// Init colly collector
+	c := createCollyCollector(ctx, EndpointProduct)
+	// Request Handler
+	c.OnRequest(func(r *colly.Request) {
+		Debug(ctx, "visiting", F("url", r.URL.String()))
+	})
+	// Error Handler
+	c.OnError(func(r *colly.Response, err error) {
+		Error(ctx, "request failed", F("url", r.Request.URL.String()), F("status", r.StatusCode), F("error", err))
+		fetchErr = newUpstreamError(r, err)
+		if r.StatusCode == http.StatusNotFound {
+			fetchErr = ErrUnknownSKU
+		}
+	})
+	// Response body contains the JSON string from API endpoint.
+	// Each model in the JSON is a variant of the product.
+	c.OnResponse(func(r *colly.Response) {
+		_, parseSpan := startSpan(ctx, "lvapi.parseProductJSON")
+		defer parseSpan.End()
+		var result map[string]interface{}
+		if err := json.Unmarshal(r.Body, &result); err != nil {
+			observeParseFailure(EndpointProduct)
+			fetchErr = ErrUnexpectedResponse
+			return
+		}
+		if result["errorCode"] != nil {
+			fetchErr = ErrUnknownSKU
+			return
+		}
+		models, _ := result["model"].([]interface{})
+		for _, m := range models {
+			item, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if variant, ok := parseLVProductVariant(item); ok {
+				variants = append(variants, variant)
+			}
+		}
+	})
+	// Send visit request to colly collector
+	if err := visit(ctx, c, endpoint); err != nil && fetchErr == nil {
+		fetchErr = &UpstreamError{URL: endpoint, Err: err}
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return variants, nil
+}
+
+// GetLVProductVariantsBySKU returns the variants of sku in region the same way as FetchLVProductVariants.
+// It returns nil if the product could not be found.
+func GetLVProductVariantsBySKU(ctx context.Context, sku string, region string) []ProductVariant {
+	variants, _ := FetchLVProductVariants(ctx, sku, region)
+	return variants
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"example.com/lvapi"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: lvctl [flags] <command> [arguments]
+
+Commands:
+  item <sku>                  availability and price of a SKU
+  family <sku>                availability of every variant in the family of a SKU
+  url <sku>                   product page URL of a SKU
+  regions                     region codes and landing page URLs
+  categories <region>         main categories of a region code or landing page URL
+  crawl <subcategory-url>     products listed on a subcategory page
+  watch <sku>                 re-check a SKU every -interval and beep on restock
+  export                      watchlist, webhooks and history of the lvtracker workspace of -key at -server, as JSON,
+                              or one -part of them as CSV with -format csv
+  import <file>               preview merging an export, JSON or CSV of one -part, into the lvtracker
+                              at -server, and merge it with -apply; - reads stdin
+
+Flags:
+`
+
+// Output format and destination for command results
+var (
+	format string
+	output = os.Stdout
+)
+
+// printResult writes a command result to output.
+// value is encoded as is for JSON, rows are written under headers for table and CSV output.
+// Headers are left out if nil.
+func printResult(value interface{}, headers []string, rows [][]string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "csv":
+		writer := csv.NewWriter(output)
+		if headers != nil {
+			writer.Write(headers)
+		}
+		writer.WriteAll(rows)
+		return writer.Error()
+	default:
+		writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+		if headers != nil {
+			fmt.Fprintln(writer, strings.Join(headers, "\t"))
+		}
+		for _, row := range rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+}
+
+// formatPrice formats a price with its currency, or returns an empty string if no price is listed.
+func formatPrice(price float64, currency string) string {
+	if price <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(price, 'f', 2, 64) + " " + currency
+}
+
+func item(ctx context.Context, sku string, region string) error {
+	product, err := lvapi.FetchLVProductAvailability(ctx, sku, region)
+	if err != nil {
+		return err
+	}
+	return printResult(product,
+		[]string{"SKU", "AVAILABLE", "PRICE"},
+		[][]string{{product.Sku, strconv.FormatBool(product.Available), formatPrice(product.Price, product.Currency)}})
+}
+
+func family(ctx context.Context, sku string, region string) error {
+	family, err := lvapi.FetchLVProductFamily(ctx, sku, region)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, v := range family.Variants {
+		rows = append(rows, []string{v.Sku, v.Color, v.Size, v.Length, strconv.FormatBool(v.Available), formatPrice(v.Price, v.Currency)})
+	}
+	return printResult(family, []string{"SKU", "COLOR", "SIZE", "LENGTH", "AVAILABLE", "PRICE"}, rows)
+}
+
+func productURL(ctx context.Context, sku string) error {
+	url, err := lvapi.GetLVProductPageURLBySKU(ctx, sku)
+	if err != nil {
+		return err
+	}
+	return printResult(map[string]string{"Sku": sku, "URL": url}, []string{"SKU", "URL"}, [][]string{{sku, url}})
+}
+
+func regions(ctx context.Context) error {
+	regions := lvapi.GetLVRegionCodesAndURLs(ctx)
+	var rows [][]string
+	for _, r := range regions {
+		rows = append(rows, []string{r.Code, r.URL})
+	}
+	return printResult(regions, []string{"CODE", "URL"}, rows)
+}
+
+func categories(ctx context.Context, region string) error {
+	// Resolve a region code to its landing page
+	url := region
+	if !strings.HasPrefix(region, "http") {
+		url = ""
+		for _, r := range lvapi.GetLVRegionCodesAndURLs(ctx) {
+			if r.Code == region {
+				url = r.URL
+				break
+			}
+		}
+		if url == "" {
+			return fmt.Errorf("unknown region: %s", region)
+		}
+	}
+	categories := lvapi.GetLVMainCategories(ctx, url)
+	var rows [][]string
+	for _, c := range categories {
+		rows = append(rows, []string{c})
+	}
+	return printResult(categories, []string{"CATEGORY"}, rows)
+}
+
+func crawl(ctx context.Context, url string) error {
+	routes := lvapi.GetLVProductPageRoutes(ctx, url)
+	var rows [][]string
+	for _, r := range routes {
+		rows = append(rows, []string{r.Name, r.Route})
+	}
+	return printResult(routes, []string{"NAME", "ROUTE"}, rows)
+}
+
+// watch checks sku every interval until interrupted, ringing the terminal bell when it restocks.
+func watch(ctx context.Context, sku string, region string, interval time.Duration) error {
+	wasAvailable := true
+	headers := []string{"TIME", "SKU", "AVAILABLE", "PRICE"}
+	for {
+		product, err := lvapi.FetchLVProductAvailability(ctx, sku, region)
+		now := time.Now().Format("15:04:05")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, now, sku, "check failed:", err)
+		} else {
+			if product.Available && !wasAvailable {
+				fmt.Fprint(output, "\a")
+			}
+			wasAvailable = product.Available
+			printResult(product, headers,
+				[][]string{{now, product.Sku, strconv.FormatBool(product.Available), formatPrice(product.Price, product.Currency)}})
+			// Print the headers only above the first check
+			headers = nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Settings of the commands calling an lvtracker server
+var (
+	server string
+	apiKey string
+	part   string
+	apply  bool
+)
+
+// serverError returns the error of a failed lvtracker response, with the message of its body.
+func serverError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, body.Error.Message)
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
+
+// serverRequest returns a request of path on the lvtracker server with query, sent with the API key.
+func serverRequest(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, serverURL(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return req, nil
+}
+
+// serverURL returns the URL of path on the lvtracker server with query.
+func serverURL(path string, query url.Values) string {
+	return strings.TrimSuffix(server, "/") + "/api/v1" + path + "?" + query.Encode()
+}
+
+// export writes the tracking setup of the server to output, as JSON, or as CSV for one part.
+func export(ctx context.Context) error {
+	query := url.Values{}
+	if part != "" {
+		query.Set("part", part)
+	}
+	if format == "csv" {
+		query.Set("format", "csv")
+	}
+	req, err := serverRequest(ctx, http.MethodGet, "/export", query, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return serverError(resp)
+	}
+	_, err = io.Copy(output, resp.Body)
+	return err
+}
+
+// importCounts represents what an import did, or would do, to a part of the tracking setup.
+type importCounts struct {
+	Added     int `json:"Added"`
+	Merged    int `json:"Merged"`
+	Unchanged int `json:"Unchanged"`
+	Skipped   int `json:"Skipped"`
+}
+
+// An importReport represents the outcome of an import, as reported by the server.
+type importReport struct {
+	DryRun    bool         `json:"DryRun"`
+	Watchlist importCounts `json:"Watchlist"`
+	Webhooks  importCounts `json:"Webhooks"`
+	History   importCounts `json:"History"`
+	Errors    []struct {
+		Part    string `json:"Part"`
+		Record  int    `json:"Record"`
+		Message string `json:"Message"`
+	} `json:"Errors"`
+}
+
+// importFile merges the export in file, - for stdin, into the tracking setup of the server, or
+// previews the merge unless apply is set. Files ending in .csv are imported as CSV of one part.
+func importFile(ctx context.Context, file string) error {
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	query := url.Values{}
+	if part != "" {
+		query.Set("part", part)
+	}
+	if apply {
+		query.Set("apply", "true")
+	}
+	contentType := "application/json"
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		contentType = "text/csv"
+	}
+	req, err := serverRequest(ctx, http.MethodPost, "/import", query, in)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		return serverError(resp)
+	}
+	var report importReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, p := range []struct {
+		name   string
+		counts importCounts
+	}{{"watchlist", report.Watchlist}, {"webhooks", report.Webhooks}, {"history", report.History}} {
+		rows = append(rows, []string{p.name, strconv.Itoa(p.counts.Added), strconv.Itoa(p.counts.Merged), strconv.Itoa(p.counts.Unchanged), strconv.Itoa(p.counts.Skipped)})
+	}
+	if err := printResult(report, []string{"PART", "ADDED", "MERGED", "UNCHANGED", "SKIPPED"}, rows); err != nil {
+		return err
+	}
+	for _, invalid := range report.Errors {
+		fmt.Fprintf(os.Stderr, "%s record %d: %s\n", invalid.Part, invalid.Record, invalid.Message)
+	}
+	switch {
+	case len(report.Errors) > 0:
+		return fmt.Errorf("%d invalid records, nothing imported", len(report.Errors))
+	case report.DryRun:
+		fmt.Fprintln(os.Stderr, "dry run, nothing imported: run again with -apply to import")
+	}
+	return nil
+}
+
+func run(ctx context.Context, command string, args []string, region string, interval time.Duration) error {
+	// Every command except regions and export takes exactly one argument
+	if (command == "regions" || command == "export") != (len(args) == 0) || len(args) > 1 {
+		return fmt.Errorf("wrong number of arguments for %s", command)
+	}
+	switch command {
+	case "item":
+		return item(ctx, args[0], region)
+	case "family":
+		return family(ctx, args[0], region)
+	case "url":
+		return productURL(ctx, args[0])
+	case "regions":
+		return regions(ctx)
+	case "categories":
+		return categories(ctx, args[0])
+	case "crawl":
+		return crawl(ctx, args[0])
+	case "watch":
+		return watch(ctx, args[0], region, interval)
+	case "export":
+		return export(ctx)
+	case "import":
+		return importFile(ctx, args[0])
+	}
+	return fmt.Errorf("unknown command: %s", command)
+}
+
+func main() {
+	flag.StringVar(&format, "format", "table", "output format: table, json or csv")
+	region := flag.String("region", lvapi.DefaultRegion, "region code to query")
+	interval := flag.Duration("interval", time.Minute, "interval between checks in watch mode")
+	verbose := flag.Bool("v", false, "log every request made to the LV API")
+	flag.StringVar(&server, "server", "http://localhost:8080", "base URL of the lvtracker server to export from and import into")
+	flag.StringVar(&apiKey, "key", os.Getenv("LVTRACKER_API_KEY"), "API key of the lvtracker workspace to export from and import into, the default workspace if empty")
+	flag.StringVar(&part, "part", "", "watchlist, webhooks or history to only export or import that part")
+	flag.BoolVar(&apply, "apply", false, "apply an import instead of previewing it")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Keep lvapi logs on stderr, out of the command output
+	level := lvapi.LevelWarn
+	if *verbose {
+		level = lvapi.LevelDebug
+	}
+	lvapi.SetLogger(lvapi.NewTextLogger(os.Stderr, level))
+
+	ctx := lvapi.WithRequestID(context.Background(), lvapi.NewRequestID())
+	if err := run(ctx, flag.Arg(0), flag.Args()[1:], *region, *interval); err != nil {
+		fmt.Fprintln(os.Stderr, "lvctl:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"example.com/lvapi"
+	"time"
+)
+
+// Hours in a week, the slots change rates are estimated for
+const hoursPerWeek = 7 * 24
+
+// Weight, in weeks of observation, pulling the change rate of an hour of the week towards the
+// average change rate of the entry, so a single past restock does not dominate the estimate
+const changeRatePriorWeeks = 1.0
+
+// Share of the average weight every entry keeps so entries that rarely change are still checked
+const minBudgetShare = 0.1
+
+// Most the poll budget of a likely hour may grow to, as a multiple of the configured budget
+const maxBudgetBoost = 4.0
+
+// Longest interval the budget assigns an entry
+const maxBudgetInterval = 24 * time.Hour
+
+// A changeProfile holds the expected number of availability changes of an entry in each hour
+// of the week, local to its region, indexed by weekday*24 + hour.
+type changeProfile [hoursPerWeek]float64
+
+// weekHour returns the changeProfile index of t.
+func weekHour(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// changeRates returns the change profile of sku in region at now, estimated from the changes
+// recorded in each hour of previous weeks and smoothed towards the average hourly rate of sku.
+// It returns false if sku has no recorded change in region.
+func changeRates(sku string, region string, now time.Time) (changeProfile, bool) {
+	var profile changeProfile
+	records := history.AvailabilityHistory(sku, region)
+	if len(records) < 2 {
+		return profile, false
+	}
+	observed := now.Sub(records[0].Time).Hours()
+	if observed < 1 {
+		return profile, false
+	}
+	location := lvapi.RegionLocation(region)
+	var changes [hoursPerWeek]int
+	// The first record is the first observation, every later one is a change
+	for _, record := range records[1:] {
+		changes[weekHour(record.Time.In(location))]++
+	}
+	average := float64(len(records)-1) / observed
+	weeks := observed / hoursPerWeek
+	for slot := range profile {
+		profile[slot] = (float64(changes[slot]) + changeRatePriorWeeks*average) / (weeks + changeRatePriorWeeks)
+	}
+	return profile, true
+}
+
+// budgetIntervals returns the interval each of entries is checked at outside its schedule
+// windows, keyed by entry key. With a poll budget configured, the weekly budget is spread over
+// the hours of the week in proportion to how likely entries are to change in each, and the
+// budget of the hour now falls in is shared between entries in proportion to their change rate,
+// entries without history counting as average. Otherwise every entry is checked every
+// configured poll interval. Intervals are not shorter than the configured minimum poll interval.
+func budgetIntervals(entries []WatchEntry, now time.Time) map[string]time.Duration {
+	config := currentConfig()
+	intervals := make(map[string]time.Duration)
+	if config.PollBudget <= 0 || len(entries) == 0 {
+		for _, entry := range entries {
+			intervals[entry.key()] = config.PollInterval
+		}
+		return intervals
+	}
+	profiles := make(map[string]changeProfile)
+	var average changeProfile
+	for _, entry := range entries {
+		// Entries with a size record the history of their variant
+		if profile, found := changeRates(entry.recordedSku(), entry.Region, now); found {
+			profiles[entry.key()] = profile
+			for slot, rate := range profile {
+				average[slot] += rate
+			}
+		}
+	}
+	for slot := range average {
+		if len(profiles) == 0 {
+			average[slot] = 1
+		} else {
+			average[slot] /= float64(len(profiles))
+		}
+	}
+	// Weight of every entry in every hour of the week, entries without history weighing average.
+	// Entries in different regions are in different local hours at now.
+	weights := make(map[string]float64)
+	current, weekly := 0.0, 0.0
+	for _, entry := range entries {
+		profile, found := profiles[entry.key()]
+		if !found {
+			profile = average
+		}
+		for slot := range profile {
+			if profile[slot] < minBudgetShare*average[slot] {
+				profile[slot] = minBudgetShare * average[slot]
+			}
+			weekly += profile[slot]
+		}
+		weights[entry.key()] = profile[weekHour(now.In(lvapi.RegionLocation(entry.Region)))]
+		current += weights[entry.key()]
+	}
+	// Hours in which entries are more likely to change get more of the weekly budget
+	boost := current * hoursPerWeek / weekly
+	if boost < minBudgetShare {
+		boost = minBudgetShare
+	}
+	if boost > maxBudgetBoost {
+		boost = maxBudgetBoost
+	}
+	for _, entry := range entries {
+		checksPerHour := float64(config.PollBudget) * boost * weights[entry.key()] / current
+		interval := time.Duration(float64(time.Hour) / checksPerHour)
+		if interval < config.MinPollInterval {
+			interval = config.MinPollInterval
+		}
+		if interval > maxBudgetInterval {
+			interval = maxBudgetInterval
+		}
+		intervals[entry.key()] = interval
+	}
+	return intervals
+}
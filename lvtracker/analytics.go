@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"example.com/lvapi"
+	"github.com/gorilla/mux"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of products returned by /api/v1/analytics/top-restocks when the request sets no limit, and the most it may set
+const (
+	defaultTopRestocksLimit = 20
+	maxTopRestocksLimit     = 100
+)
+
+// A RestockAnalytics represents restock statistics of a product in a region, computed from its
+// recorded availability history.
+type RestockAnalytics struct {
+	Sku                   string     `json:"Sku"`                   // Product identifier
+	Region                string     `json:"Region"`                // Region code
+	ObservedSince         time.Time  `json:"ObservedSince"`         // Time the availability was first recorded
+	Available             bool       `json:"Available"`             // Last recorded availability
+	Restocks              int        `json:"Restocks"`              // Times the product came back in stock
+	RestocksPerWeek       float64    `json:"RestocksPerWeek"`       // Restocks per week of observation
+	AverageInStockSeconds float64    `json:"AverageInStockSeconds"` // Mean length of the periods in stock that ended, zero if none did
+	InStockRatio          float64    `json:"InStockRatio"`          // Share of the observed time the product was in stock
+	MedianSellOutSeconds  float64    `json:"MedianSellOutSeconds"`  // Median time from a restock to selling out, zero if no restock sold out
+	CommonRestockHour     *int       `json:"CommonRestockHour"`     // Hour of the day, local to the region, most restocks happened in, null if none
+	LastRestock           *time.Time `json:"LastRestock"`           // Time of the last restock, null if none
+}
+
+// analyzeAvailability returns the restock statistics of sku in region at now from records, the
+// availability records of sku in region oldest first. records must not be empty.
+func analyzeAvailability(sku string, region string, records []AvailabilityRecord, now time.Time) RestockAnalytics {
+	analytics := RestockAnalytics{Sku: sku, Region: region, ObservedSince: records[0].Time, Available: records[len(records)-1].Available}
+	location := lvapi.RegionLocation(region)
+	var inStock, periods time.Duration
+	var periodCount int
+	var sellOuts []time.Duration
+	var restockHours [24]int
+	for i, record := range records {
+		end := now
+		if i+1 < len(records) {
+			end = records[i+1].Time
+		}
+		if !record.Available {
+			continue
+		}
+		inStock += end.Sub(record.Time)
+		restock := i > 0 && !records[i-1].Available
+		if restock {
+			analytics.Restocks++
+			restockHours[record.Time.In(location).Hour()]++
+			restockTime := record.Time
+			analytics.LastRestock = &restockTime
+		}
+		// Periods still in stock have not ended yet
+		if i+1 < len(records) {
+			periods += end.Sub(record.Time)
+			periodCount++
+			if restock {
+				sellOuts = append(sellOuts, end.Sub(record.Time))
+			}
+		}
+	}
+	if observed := now.Sub(analytics.ObservedSince); observed > 0 {
+		analytics.InStockRatio = inStock.Seconds() / observed.Seconds()
+		analytics.RestocksPerWeek = float64(analytics.Restocks) / (observed.Hours() / (7 * 24))
+	}
+	if periodCount > 0 {
+		analytics.AverageInStockSeconds = periods.Seconds() / float64(periodCount)
+	}
+	if len(sellOuts) > 0 {
+		sort.Slice(sellOuts, func(i, j int) bool { return sellOuts[i] < sellOuts[j] })
+		middle := len(sellOuts) / 2
+		median := sellOuts[middle]
+		if len(sellOuts)%2 == 0 {
+			median = (sellOuts[middle-1] + sellOuts[middle]) / 2
+		}
+		analytics.MedianSellOutSeconds = median.Seconds()
+	}
+	if analytics.Restocks > 0 {
+		common := 0
+		for hour, count := range restockHours {
+			if count > restockHours[common] {
+				common = hour
+			}
+		}
+		analytics.CommonRestockHour = &common
+	}
+	return analytics
+}
+
+// skuAnalytics returns the restock statistics of sku in each region its availability was
+// recorded in, or only in region if it is not empty, ordered by region.
+func skuAnalytics(sku string, region string, now time.Time) []RestockAnalytics {
+	byRegion := make(map[string][]AvailabilityRecord)
+	for _, record := range history.AvailabilityHistory(sku, region) {
+		byRegion[record.Region] = append(byRegion[record.Region], record)
+	}
+	results := []RestockAnalytics{}
+	for region, records := range byRegion {
+		results = append(results, analyzeAvailability(sku, region, records, now))
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Region < results[j].Region })
+	return results
+}
+
+// wantsCSV returns whether the request asks for CSV, with format=csv or an Accept header
+// preferring text/csv.
+func wantsCSV(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.EqualFold(format, "csv")
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// writeAnalyticsCSV answers the request with analytics as a CSV attachment named filename.
+func writeAnalyticsCSV(w http.ResponseWriter, filename string, analytics []RestockAnalytics) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{"Sku", "Region", "ObservedSince", "Available", "Restocks", "RestocksPerWeek",
+		"AverageInStockSeconds", "InStockRatio", "MedianSellOutSeconds", "CommonRestockHour", "LastRestock"})
+	for _, a := range analytics {
+		commonRestockHour, lastRestock := "", ""
+		if a.CommonRestockHour != nil {
+			commonRestockHour = strconv.Itoa(*a.CommonRestockHour)
+		}
+		if a.LastRestock != nil {
+			lastRestock = a.LastRestock.Format(time.RFC3339)
+		}
+		out.Write([]string{
+			a.Sku, a.Region, a.ObservedSince.Format(time.RFC3339), strconv.FormatBool(a.Available),
+			strconv.Itoa(a.Restocks), strconv.FormatFloat(a.RestocksPerWeek, 'f', 3, 64),
+			strconv.FormatFloat(a.AverageInStockSeconds, 'f', 0, 64), strconv.FormatFloat(a.InStockRatio, 'f', 4, 64),
+			strconv.FormatFloat(a.MedianSellOutSeconds, 'f', 0, 64), commonRestockHour, lastRestock,
+		})
+	}
+	out.Flush()
+}
+
+func returnItemAnalytics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p := requestPrincipal(r)
+	if !p.views(vars["sku"], r.URL.Query().Get("region")) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "SKU not watched by the workspace: "+vars["sku"], false)
+		return
+	}
+	analytics := []RestockAnalytics{}
+	for _, a := range skuAnalytics(vars["sku"], r.URL.Query().Get("region"), time.Now()) {
+		if p.views(a.Sku, a.Region) {
+			analytics = append(analytics, a)
+		}
+	}
+	if len(analytics) == 0 {
+		writeError(w, http.StatusNotFound, CodeNotFound, "No availability recorded for "+vars["sku"], false)
+		return
+	}
+	if wantsCSV(r) {
+		writeAnalyticsCSV(w, "analytics-"+vars["sku"]+".csv", analytics)
+		return
+	}
+	json.NewEncoder(w).Encode(analytics)
+}
+
+func returnTopRestocks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultTopRestocksLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxTopRestocksLimit {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxTopRestocksLimit), false)
+			return
+		}
+	}
+	now := time.Now()
+	p := requestPrincipal(r)
+	top := []RestockAnalytics{}
+	for _, sku := range history.AvailabilitySkus() {
+		if !p.views(sku, query.Get("region")) {
+			continue
+		}
+		for _, analytics := range skuAnalytics(sku, query.Get("region"), now) {
+			if analytics.Restocks > 0 && p.views(sku, analytics.Region) {
+				top = append(top, analytics)
+			}
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Restocks != top[j].Restocks {
+			return top[i].Restocks > top[j].Restocks
+		}
+		if top[i].RestocksPerWeek != top[j].RestocksPerWeek {
+			return top[i].RestocksPerWeek > top[j].RestocksPerWeek
+		}
+		return top[i].Sku+top[i].Region < top[j].Sku+top[j].Region
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	if wantsCSV(r) {
+		writeAnalyticsCSV(w, "top-restocks.csv", top)
+		return
+	}
+	json.NewEncoder(w).Encode(top)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/lvapi"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Maximum number of SKU and region pairs checked by a single bulk request
+const maxBulkChecks = 1000
+
+// A BulkAvailabilityRequest represents the SKUs and regions checked by a bulk availability request.
+type BulkAvailabilityRequest struct {
+	Skus    []string `json:"Skus"`    // Product identifiers to check
+	Regions []string `json:"Regions"` // Region codes to check each sku in, the configured region if empty
+}
+
+// A BulkAvailabilityResult represents the availability of one sku in one region.
+// Error is set instead of failing the whole batch when the check failed.
+type BulkAvailabilityResult struct {
+	Sku       string  `json:"Sku"`             // Product identifier
+	Region    string  `json:"Region"`          // Region code
+	Available bool    `json:"Available"`       // Product availability
+	Price     float64 `json:"Price"`           // Product price, zero if not listed
+	Currency  string  `json:"Currency"`        // Product price currency code
+	Error     string  `json:"Error,omitempty"` // Reason the check failed
+}
+
+// checkAvailabilityInBulk checks every sku in every region of request using a pool of as many workers as
+// configured.
+// Results are sent to results in order of completion, and results is closed once every check is done.
+// Checks not yet started when ctx is done are skipped.
+func checkAvailabilityInBulk(ctx context.Context, request BulkAvailabilityRequest, results chan<- BulkAvailabilityResult) {
+	jobs := make(chan BulkAvailabilityResult)
+	var wg sync.WaitGroup
+	workers := currentConfig().BulkWorkers
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				product, err := lvapi.FetchLVProductAvailability(ctx, job.Sku, job.Region)
+				if err != nil {
+					job.Error = err.Error()
+				} else {
+					recordProduct(ctx, product, job.Region)
+					job.Available, job.Price, job.Currency = product.Available, product.Price, product.Currency
+				}
+				results <- job
+			}
+		}()
+	}
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+			close(results)
+		}()
+		for _, sku := range request.Skus {
+			for _, region := range request.Regions {
+				select {
+				case jobs <- BulkAvailabilityResult{Sku: sku, Region: region}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+}
+
+func returnBulkAvailability(w http.ResponseWriter, r *http.Request) {
+	var request BulkAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid bulk availability request: "+err.Error(), false)
+		return
+	}
+	// Drop blank and duplicate SKUs and regions
+	request.Skus = uniqueStrings(request.Skus)
+	request.Regions = uniqueStrings(request.Regions)
+	if len(request.Regions) == 0 {
+		request.Regions = []string{currentConfig().Region}
+	}
+	if len(request.Skus) == 0 {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Bulk availability request requires at least one Sku", false)
+		return
+	}
+	for _, sku := range request.Skus {
+		if err := lvapi.ValidateSKU(sku); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidSKU, "Malformed SKU: "+sku, false)
+			return
+		}
+	}
+	if len(request.Skus)*len(request.Regions) > maxBulkChecks {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("Bulk availability request is limited to %d SKU and region pairs", maxBulkChecks), false)
+		return
+	}
+
+	// Stream each result as a line of NDJSON as soon as it completes.
+	// Results still in flight when the client goes away are drained and discarded.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	results := make(chan BulkAvailabilityResult)
+	checkAvailabilityInBulk(r.Context(), request, results)
+	encoder := json.NewEncoder(w)
+	for result := range results {
+		if r.Context().Err() != nil {
+			continue
+		}
+		encoder.Encode(result)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// uniqueStrings returns values trimmed, without blanks and duplicates, in their original order.
+func uniqueStrings(values []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
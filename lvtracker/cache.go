@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Number of values a Cache holds at most, keys come from requests so they are not bounded otherwise
+const maxCacheEntries = 10000
+
+// A cacheEntry represents a cached value and the time it expires at.
+type cacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// A Cache holds values for a fixed time to live so repeated lookups don't hit the LV API.
+// It holds at most maxCacheEntries values, evicting the least recently used one beyond that.
+// Lookups are counted in the cache metrics under the cache name.
+type Cache struct {
+	mu      sync.Mutex
+	name    string
+	ttl     time.Duration
+	entries map[string]*list.Element
+	recency *list.List // Entries, most recently used first
+}
+
+// NewCache creates a Cache named name keeping values for ttl.
+// It returns the created Cache.
+func NewCache(name string, ttl time.Duration) *Cache {
+	return &Cache{name: name, ttl: ttl, entries: make(map[string]*list.Element), recency: list.New()}
+}
+
+// Get returns the value cached under key and whether it was found and has not expired.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, found := c.entries[key]
+	if found && time.Now().After(element.Value.(*cacheEntry).expires) {
+		c.remove(element)
+		found = false
+	}
+	if !found {
+		cacheLookups.WithLabelValues(c.name, "miss").Inc()
+		return nil, false
+	}
+	c.recency.MoveToFront(element)
+	cacheLookups.WithLabelValues(c.name, "hit").Inc()
+	return element.Value.(*cacheEntry).value, true
+}
+
+// SetTTL replaces the time to live of values cached from now on.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Set caches value under key until the time to live has passed.
+// Expired values that were not used since are swept, and the least recently used value is
+// evicted if the cache is full.
+func (c *Cache) Set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if element, found := c.entries[key]; found {
+		element.Value = &cacheEntry{key: key, value: value, expires: now.Add(c.ttl)}
+		c.recency.MoveToFront(element)
+	} else {
+		c.entries[key] = c.recency.PushFront(&cacheEntry{key: key, value: value, expires: now.Add(c.ttl)})
+	}
+	for oldest := c.recency.Back(); oldest != nil; oldest = c.recency.Back() {
+		if len(c.entries) <= maxCacheEntries && !now.After(oldest.Value.(*cacheEntry).expires) {
+			break
+		}
+		c.remove(oldest)
+	}
+}
+
+// remove drops element from the cache. The caller must hold c.mu.
+func (c *Cache) remove(element *list.Element) {
+	c.recency.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"example.com/lvapi"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of catalog events kept for /api/events/catalog
+const maxCatalogEvents = 500
+
+// Matches a product sku such as M40995 at the end of a product route
+var routeSKUPattern = regexp.MustCompile(`[A-Z][A-Z0-9]{4,}$`)
+
+// A CatalogWatcher periodically crawls subcategory pages and reports products that were added,
+// removed or renamed since the previous crawl.
+type CatalogWatcher struct {
+	mu            sync.Mutex
+	subcategories []string
+	snapshots     map[string]map[string]lvapi.ProductRoute // Products keyed by catalogKey, by subcategory URL
+	events        []Event
+}
+
+// catalogKey returns what identifies product across crawls: the sku of its route, so a product
+// keeps its key when its route changes with its name, or the route if it has no sku.
+func catalogKey(product lvapi.ProductRoute) string {
+	if sku := skuFromRoute(product.Route); sku != "" {
+		return sku
+	}
+	return product.Route
+}
+
+// NewCatalogWatcher creates a CatalogWatcher for the subcategory page URLs in subcategories.
+// It returns the created CatalogWatcher.
+func NewCatalogWatcher(subcategories []string) *CatalogWatcher {
+	return &CatalogWatcher{subcategories: subcategories, snapshots: make(map[string]map[string]lvapi.ProductRoute)}
+}
+
+// SetSubcategories replaces the subcategory page URLs crawled from the next crawl cycle on.
+func (c *CatalogWatcher) SetSubcategories(subcategories []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subcategories = subcategories
+}
+
+// Run crawls every subcategory once per configured catalog interval until ctx is done.
+// A crawl in progress when ctx is done is finished, the remaining subcategories are skipped.
+// Each crawl cycle is logged under its own request ID.
+func (c *CatalogWatcher) Run(ctx context.Context) {
+	for {
+		cycle := lvapi.WithRequestID(ctx, lvapi.NewRequestID())
+		c.mu.Lock()
+		subcategories := c.subcategories
+		c.mu.Unlock()
+		for _, subcategory := range subcategories {
+			if ctx.Err() != nil {
+				return
+			}
+			c.Check(cycle, subcategory)
+		}
+		pollCycles.WithLabelValues("catalog").Inc()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(currentConfig().CatalogInterval):
+		}
+	}
+}
+
+// Check crawls subcategory and diffs its products against the previous snapshot, matching
+// products by sku so a product whose name or route changed is reported as renamed.
+// The first crawl of a subcategory only records the snapshot. A crawl returning no products
+// is treated as a failed crawl and ignored so it does not report every product as removed.
+// Every successful crawl also reindexes the subcategory for search and stores new product images.
+func (c *CatalogWatcher) Check(ctx context.Context, subcategory string) {
+	routes := lvapi.GetLVProductPageRoutes(ctx, subcategory)
+	snapshot := make(map[string]lvapi.ProductRoute)
+	for _, product := range routes {
+		snapshot[catalogKey(product)] = product
+	}
+	if len(snapshot) == 0 {
+		lvapi.Warn(ctx, "no products found in subcategory", lvapi.F("url", subcategory))
+		return
+	}
+	images := lvapi.GetLVProductImages(ctx, subcategory)
+	searchIndex.IndexSubcategory(subcategory, routes, images)
+	imageStore.StoreListed(ctx, routes, images)
+	c.mu.Lock()
+	previous, found := c.snapshots[subcategory]
+	c.snapshots[subcategory] = snapshot
+	c.mu.Unlock()
+	if !found {
+		return
+	}
+	for key, product := range snapshot {
+		previousProduct, existed := previous[key]
+		if !existed {
+			c.emit(ctx, Event{Type: EventNewProduct, Sku: skuFromRoute(product.Route), URL: product.Route, Message: "new product: " + product.Name})
+		} else if previousProduct.Name != product.Name {
+			c.emit(ctx, Event{Type: EventRenamedProduct, Sku: skuFromRoute(product.Route), URL: product.Route, Message: "renamed from " + previousProduct.Name + " to " + product.Name})
+		} else if previousProduct.Route != product.Route {
+			c.emit(ctx, Event{Type: EventRenamedProduct, Sku: skuFromRoute(product.Route), URL: product.Route, Message: "moved from " + previousProduct.Route + " to " + product.Route})
+		}
+	}
+	for key, product := range previous {
+		if _, exists := snapshot[key]; !exists {
+			c.emit(ctx, Event{Type: EventRemovedProduct, Sku: skuFromRoute(product.Route), URL: product.Route, Message: "removed product: " + product.Name})
+		}
+	}
+}
+
+// emit sends event to the notifier and keeps it for Events.
+func (c *CatalogWatcher) emit(ctx context.Context, event Event) {
+	event.Time = time.Now()
+	notifier.Notify(ctx, event)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	if len(c.events) > maxCatalogEvents {
+		c.events = c.events[len(c.events)-maxCatalogEvents:]
+	}
+}
+
+// Events returns the catalog events emitted after since, oldest first.
+func (c *CatalogWatcher) Events(since time.Time) []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := []Event{}
+	for _, event := range c.events {
+		if event.Time.After(since) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// skuFromRoute returns the product sku at the end of a product route, or an empty string if there is none.
+func skuFromRoute(route string) string {
+	route = strings.TrimRight(strings.SplitN(route, "?", 2)[0], "/")
+	return routeSKUPattern.FindString(route[strings.LastIndex(route, "/")+1:])
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"example.com/lvapi"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Prefix of the environment variables overriding configuration file settings
+const envPrefix = "LVTRACKER_"
+
+// Shortest admin key accepted, so it cannot be guessed
+const minAdminKeyLength = 16
+
+// A Config represents the settings of lvtracker. Every setting is read from, in increasing order
+// of precedence, its default, the YAML configuration file, the environment and the command line.
+// The YAML key of a setting is its flag name with underscores, and its environment variable is
+// that key in upper case prefixed with LVTRACKER_, e.g. poll_interval and LVTRACKER_POLL_INTERVAL.
+type Config struct {
+	Listen               string        `yaml:"listen"`                // Address the HTTP server listens on
+	Region               string        `yaml:"region"`                // Region code used when a request has none
+	HistoryPath          string        `yaml:"history"`               // File to persist price and availability history to
+	WatchlistPath        string        `yaml:"watchlist"`             // File to persist the watchlist to
+	SubscriptionsPath    string        `yaml:"subscriptions"`         // File to persist webhooks subscribed at runtime to
+	WorkspacesPath       string        `yaml:"workspaces"`            // Directory to persist workspaces, their keys, watchlists and webhooks to
+	AdminKey             string        `yaml:"admin_key"`             // API key of the administrator, required to create workspaces
+	ImagesPath           string        `yaml:"images"`                // Directory to store product images and thumbnails in
+	ThumbnailSize        int           `yaml:"thumbnail_size"`        // Width and height thumbnails are scaled down to fit
+	Webhooks             []string      `yaml:"webhooks"`              // Webhook URLs to post notifications to
+	WebhookAllowlist     []string      `yaml:"webhook_allowlist"`     // Hosts and CIDR ranges webhooks may resolve to despite being private
+	PriceThreshold       float64       `yaml:"price_threshold"`       // Percentage a price has to change by to notify
+	PollInterval         time.Duration `yaml:"poll_interval"`         // Interval between watchlist availability checks
+	MinPollInterval      time.Duration `yaml:"min_poll_interval"`     // Shortest interval a watchlist schedule may poll an entry at
+	PollBudget           int           `yaml:"poll_budget"`           // Watchlist checks per hour shared by restock likelihood, 0 to use poll_interval
+	RequestInterval      time.Duration `yaml:"request_interval"`      // Minimum time between two requests to LV endpoints
+	CacheTTL             time.Duration `yaml:"cache_ttl"`             // Time to cache families and store availability for
+	CatalogSubcategories []string      `yaml:"catalog_subcategories"` // Subcategory page URLs to watch and index for search by name
+	CatalogInterval      time.Duration `yaml:"catalog_interval"`      // Interval between subcategory crawls
+	BulkWorkers          int           `yaml:"bulk_workers"`          // Concurrent availability checks per bulk request
+	ExchangeRatesPath    string        `yaml:"exchange_rates"`        // JSON exchange rate table for price comparison
+	CORSOrigins          []string      `yaml:"cors_origins"`          // Origins allowed to call the API, * for any
+	UpstreamAPI          string        `yaml:"upstream_api"`          // Base URL of the LV API
+	UpstreamWebsite      string        `yaml:"upstream_website"`      // Base URL of the LV website
+	LogLevel             string        `yaml:"log_level"`             // Minimum log level
+	LogFormat            string        `yaml:"log_format"`            // Log output format, text or json
+	ReadTimeout          time.Duration `yaml:"read_timeout"`          // Maximum time to read a request
+	WriteTimeout         time.Duration `yaml:"write_timeout"`         // Maximum time to write a response, or each part of a streamed one
+	IdleTimeout          time.Duration `yaml:"idle_timeout"`          // Maximum time to keep an idle connection open
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`      // Maximum time to drain requests and jobs on exit
+
+	exchangeRates *lvapi.ExchangeRates // Table loaded from ExchangeRatesPath, nil if there is none
+}
+
+// defaultConfig returns the settings used when neither the configuration file, the environment
+// nor the command line sets them.
+func defaultConfig() Config {
+	return Config{
+		Listen:          ":8080",
+		Region:          lvapi.DefaultRegion,
+		PollInterval:    5 * time.Minute,
+		MinPollInterval: 10 * time.Second,
+		RequestInterval: 100 * time.Millisecond,
+		CacheTTL:        10 * time.Minute,
+		CatalogInterval: 15 * time.Minute,
+		BulkWorkers:     8,
+		ThumbnailSize:   256,
+		UpstreamAPI:     lvapi.DefaultHosts.API,
+		UpstreamWebsite: lvapi.DefaultHosts.Website,
+		LogLevel:        "info",
+		LogFormat:       "text",
+		ReadTimeout:     15 * time.Second,
+		WriteTimeout:    2 * time.Minute,
+		IdleTimeout:     time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// A listFlag is a comma separated list flag.
+type listFlag struct {
+	values *[]string
+}
+
+func (l listFlag) String() string {
+	if l.values == nil {
+		return ""
+	}
+	return strings.Join(*l.values, ",")
+}
+
+func (l listFlag) Set(value string) error {
+	*l.values = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l.values = append(*l.values, v)
+		}
+	}
+	return nil
+}
+
+// bindFlags defines a flag on fs for every setting of c, storing flag values into c.
+func bindFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address the HTTP server listens on")
+	fs.StringVar(&c.Region, "region", c.Region, "region code used when a request has none")
+	fs.StringVar(&c.HistoryPath, "history", c.HistoryPath, "file to persist price and availability history to")
+	fs.StringVar(&c.WatchlistPath, "watchlist", c.WatchlistPath, "file to persist the watchlist to")
+	fs.StringVar(&c.SubscriptionsPath, "subscriptions", c.SubscriptionsPath, "file to persist webhooks subscribed at runtime, such as by an import, to")
+	fs.StringVar(&c.WorkspacesPath, "workspaces", c.WorkspacesPath, "directory to persist workspaces, their API keys, watchlists and webhooks to")
+	fs.StringVar(&c.AdminKey, "admin-key", c.AdminKey, "API key of the administrator, who manages workspaces and owns the default workspace; required to create workspaces; requests without API key act as the administrator while empty and no workspace exists")
+	fs.StringVar(&c.ImagesPath, "images", c.ImagesPath, "directory to store downloaded product images and thumbnails in")
+	fs.IntVar(&c.ThumbnailSize, "thumbnail-size", c.ThumbnailSize, "width and height in pixels product image thumbnails are scaled down to fit")
+	fs.Var(listFlag{&c.Webhooks}, "webhooks", "comma separated webhook URLs to post notifications to")
+	fs.Var(listFlag{&c.WebhookAllowlist}, "webhook-allowlist", "comma separated hosts and CIDR ranges webhooks subscribed at runtime may use despite resolving to private, loopback or link-local addresses")
+	fs.Float64Var(&c.PriceThreshold, "price-threshold", c.PriceThreshold, "percentage a price has to change by to send a notification")
+	fs.DurationVar(&c.PollInterval, "poll-interval", c.PollInterval, "interval between watchlist availability checks")
+	fs.DurationVar(&c.MinPollInterval, "min-poll-interval", c.MinPollInterval, "shortest interval a watchlist schedule may poll an entry at")
+	fs.IntVar(&c.PollBudget, "poll-budget", c.PollBudget, "watchlist checks per hour shared between entries by their restock likelihood, 0 to check every entry each poll interval")
+	fs.DurationVar(&c.RequestInterval, "request-interval", c.RequestInterval, "minimum time between two requests to LV endpoints, 0 for no limit")
+	fs.DurationVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "time to cache product family graphs and store availability for")
+	fs.Var(listFlag{&c.CatalogSubcategories}, "catalog-subcategories", "comma separated subcategory page URLs to watch for new and removed products, and to index for search by product name")
+	fs.DurationVar(&c.CatalogInterval, "catalog-interval", c.CatalogInterval, "interval between subcategory crawls")
+	fs.IntVar(&c.BulkWorkers, "bulk-workers", c.BulkWorkers, "number of concurrent availability checks per bulk request")
+	fs.StringVar(&c.ExchangeRatesPath, "exchange-rates", c.ExchangeRatesPath, "JSON exchange rate table used to compare prices across regions")
+	fs.Var(listFlag{&c.CORSOrigins}, "cors-origins", "comma separated origins allowed to call the API, * for any")
+	fs.StringVar(&c.UpstreamAPI, "upstream-api", c.UpstreamAPI, "base URL of the LV API")
+	fs.StringVar(&c.UpstreamWebsite, "upstream-website", c.UpstreamWebsite, "base URL of the LV website")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log output format: text or json")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum time to read a request, headers and body")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum time to write a response, or each part of streamed bulk results and price comparisons")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "maximum time to keep an idle keep-alive connection open")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "maximum time to drain in-flight requests and background jobs on SIGTERM")
+}
+
+// envName returns the environment variable of the setting with flag name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// LoadConfig reads the configuration file at path, if path is not empty, over the defaults,
+// then applies the LVTRACKER_ environment variables and finally flags, keyed by flag name.
+// It returns the validated configuration, or an error naming the first invalid setting.
+func LoadConfig(path string, flags map[string]string) (Config, error) {
+	config := defaultConfig()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	bindFlags(fs, &config)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, found := os.LookupEnv(envName(f.Name)); found && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return Config{}, fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+	if config.ExchangeRatesPath != "" {
+		rates, err := lvapi.LoadExchangeRates(config.ExchangeRatesPath)
+		if err != nil {
+			return Config{}, fmt.Errorf("exchange_rates: %w", err)
+		}
+		config.exchangeRates = &rates
+	}
+	return config, nil
+}
+
+// Matches a region code such as eng-ca
+var regionCodePattern = regexp.MustCompile(`^[a-z]{3}-[a-z0-9]{2}$`)
+
+// validate returns an error naming the first setting of c that is invalid.
+func (c Config) validate() error {
+	if c.Listen == "" {
+		return errors.New("listen: address is required")
+	}
+	if !regionCodePattern.MatchString(c.Region) {
+		return fmt.Errorf("region: %q is not a region code such as eng-ca", c.Region)
+	}
+	if c.PriceThreshold < 0 {
+		return errors.New("price_threshold: must not be negative")
+	}
+	for name, interval := range map[string]time.Duration{
+		"poll_interval": c.PollInterval, "min_poll_interval": c.MinPollInterval, "catalog_interval": c.CatalogInterval, "cache_ttl": c.CacheTTL,
+		"read_timeout": c.ReadTimeout, "write_timeout": c.WriteTimeout, "idle_timeout": c.IdleTimeout, "shutdown_timeout": c.ShutdownTimeout,
+	} {
+		if interval <= 0 {
+			return fmt.Errorf("%s: must be positive", name)
+		}
+	}
+	if c.BulkWorkers < 1 {
+		return errors.New("bulk_workers: must be at least 1")
+	}
+	if c.PollBudget < 0 {
+		return errors.New("poll_budget: must not be negative")
+	}
+	if c.RequestInterval < 0 {
+		return errors.New("request_interval: must not be negative")
+	}
+	if c.AdminKey != "" && len(c.AdminKey) < minAdminKeyLength {
+		return fmt.Errorf("admin_key: must be at least %d characters", minAdminKeyLength)
+	}
+	if c.ThumbnailSize < 1 {
+		return errors.New("thumbnail_size: must be at least 1")
+	}
+	if _, err := lvapi.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format: %q is neither text nor json", c.LogFormat)
+	}
+	for _, webhook := range c.Webhooks {
+		if !isHTTPURL(webhook) {
+			return fmt.Errorf("webhooks: %q is not an http or https URL", webhook)
+		}
+	}
+	for _, subcategory := range c.CatalogSubcategories {
+		if !isHTTPURL(subcategory) {
+			return fmt.Errorf("catalog_subcategories: %q is not an http or https URL", subcategory)
+		}
+	}
+	for _, origin := range c.CORSOrigins {
+		if origin != "*" && !isHTTPURL(origin) {
+			return fmt.Errorf("cors_origins: %q is neither * nor an http or https origin", origin)
+		}
+	}
+	if !isHTTPURL(c.UpstreamAPI) {
+		return fmt.Errorf("upstream_api: %q is not an http or https URL", c.UpstreamAPI)
+	}
+	if !isHTTPURL(c.UpstreamWebsite) {
+		return fmt.Errorf("upstream_website: %q is not an http or https URL", c.UpstreamWebsite)
+	}
+	return nil
+}
+
+// isHTTPURL returns whether value is an absolute http or https URL.
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Configuration currently applied
+var (
+	configMu sync.RWMutex
+	config   Config
+)
+
+// currentConfig returns the configuration currently applied.
+func currentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// applyConfig makes c the current configuration and applies the settings that take effect
+// without a restart: logging, upstream hosts, webhooks, watched subcategories and cache time
+// to live. Intervals, thresholds and the default region are read from the current configuration
+// when used.
+func applyConfig(c Config) {
+	level, _ := lvapi.ParseLevel(c.LogLevel)
+	if c.LogFormat == "json" {
+		lvapi.SetLogger(lvapi.NewJSONLogger(os.Stderr, level))
+	} else {
+		lvapi.SetLogger(lvapi.NewTextLogger(os.Stderr, level))
+	}
+	lvapi.SetHosts(lvapi.Hosts{API: strings.TrimSuffix(c.UpstreamAPI, "/"), Website: strings.TrimSuffix(c.UpstreamWebsite, "/")})
+	lvapi.SetRequestInterval(c.RequestInterval)
+	if notifier != nil {
+		notifier.SetWebhooks(c.Webhooks)
+	}
+	if familyCache != nil {
+		familyCache.SetTTL(c.CacheTTL)
+	}
+	if storeCache != nil {
+		storeCache.SetTTL(c.CacheTTL)
+	}
+	if regionCache != nil {
+		regionCache.SetTTL(c.CacheTTL)
+	}
+	if catalogWatcher != nil {
+		catalogWatcher.SetSubcategories(c.CatalogSubcategories)
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = c
+}
+
+// reloadOnHangup reloads the configuration from path, with flags still taking precedence,
+// every time the process receives SIGHUP. An invalid configuration is logged and ignored.
+// The server settings and storage paths are only read at startup and need a restart to change.
+func reloadOnHangup(path string, flags map[string]string) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	for range hangups {
+		ctx := lvapi.WithRequestID(context.Background(), lvapi.NewRequestID())
+		reloaded, err := LoadConfig(path, flags)
+		if err != nil {
+			lvapi.Error(ctx, "configuration not reloaded", lvapi.F("error", err))
+			continue
+		}
+		if keepStartupSettings(&reloaded, currentConfig()) {
+			lvapi.Warn(ctx, "server settings and storage paths only change on restart")
+		}
+		applyConfig(reloaded)
+		lvapi.Info(ctx, "configuration reloaded", lvapi.F("path", path))
+	}
+}
+
+// keepStartupSettings replaces the settings of reloaded that are only read at startup with
+// those of previous. It returns whether any of them had changed.
+func keepStartupSettings(reloaded *Config, previous Config) bool {
+	changed := reloaded.Listen != previous.Listen ||
+		reloaded.HistoryPath != previous.HistoryPath ||
+		reloaded.WatchlistPath != previous.WatchlistPath ||
+		reloaded.SubscriptionsPath != previous.SubscriptionsPath ||
+		reloaded.WorkspacesPath != previous.WorkspacesPath ||
+		reloaded.ImagesPath != previous.ImagesPath ||
+		reloaded.ReadTimeout != previous.ReadTimeout ||
+		reloaded.WriteTimeout != previous.WriteTimeout ||
+		reloaded.IdleTimeout != previous.IdleTimeout ||
+		reloaded.ShutdownTimeout != previous.ShutdownTimeout
+	reloaded.Listen, reloaded.HistoryPath, reloaded.WatchlistPath = previous.Listen, previous.HistoryPath, previous.WatchlistPath
+	reloaded.SubscriptionsPath, reloaded.ImagesPath = previous.SubscriptionsPath, previous.ImagesPath
+	reloaded.WorkspacesPath = previous.WorkspacesPath
+	reloaded.ReadTimeout, reloaded.WriteTimeout = previous.ReadTimeout, previous.WriteTimeout
+	reloaded.IdleTimeout, reloaded.ShutdownTimeout = previous.IdleTimeout, previous.ShutdownTimeout
+	return changed
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"example.com/lvapi"
+	"github.com/gorilla/mux"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// Error codes of APIError
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidSKU       = "invalid_sku"
+	CodeNotFound         = "not_found"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeUnknownSKU       = "unknown_sku"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "too_large"
+	CodeUpstreamError    = "upstream_error"
+	CodeUpstreamBlocked  = "upstream_blocked"
+	CodeUnavailable      = "unavailable"
+)
+
+// An APIError represents why an API request failed.
+type APIError struct {
+	Code      string `json:"Code"`      // Machine readable error code
+	Message   string `json:"Message"`   // Human readable description
+	Retryable bool   `json:"Retryable"` // Whether the same request may succeed later
+}
+
+// An ErrorResponse represents the body of every failed API request.
+type ErrorResponse struct {
+	Error APIError `json:"Error"` // Reason the request failed
+}
+
+// writeError answers the request with status and an ErrorResponse.
+func writeError(w http.ResponseWriter, status int, code string, message string, retryable bool) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: APIError{Code: code, Message: message, Retryable: retryable}})
+}
+
+// writeLVAPIError answers the request with the status matching err, an error returned by lvapi:
+// 400 for a malformed sku, 404 for an unknown sku, 503 when the LV API blocks requests, with a
+// Retry-After of when the lvapi circuit breaker lets requests through again, and 502 for any
+// other upstream failure.
+func writeLVAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, lvapi.ErrInvalidSKU):
+		writeError(w, http.StatusBadRequest, CodeInvalidSKU, err.Error(), false)
+	case errors.Is(err, lvapi.ErrUnknownSKU):
+		writeError(w, http.StatusNotFound, CodeUnknownSKU, err.Error(), false)
+	case errors.Is(err, lvapi.ErrBlocked):
+		lvapi.Warn(r.Context(), "blocked by LV API", lvapi.F("error", err))
+		if wait := lvapi.CircuitRetryAfter(); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		writeError(w, http.StatusServiceUnavailable, CodeUpstreamBlocked, "LV API is refusing requests, try again later", true)
+	default:
+		lvapi.Error(r.Context(), "LV API request failed", lvapi.F("error", err))
+		writeError(w, http.StatusBadGateway, CodeUpstreamError, err.Error(), true)
+	}
+}
+
+// validateSKU rejects requests whose sku route variable is malformed before next makes any
+// request to the LV API.
+func validateSKU(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sku, found := mux.Vars(r)["sku"]; found {
+			if err := lvapi.ValidateSKU(sku); err != nil {
+				writeError(w, http.StatusBadRequest, CodeInvalidSKU, "Malformed SKU: "+sku, false)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// returnNotFound answers requests matching no route.
+func returnNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, CodeNotFound, "No route for "+r.URL.Path, false)
+}
+
+// returnMethodNotAllowed answers requests matching a route registered for other methods.
+func returnMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path, false)
+}
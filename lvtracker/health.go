@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/lvapi"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Interval the reachability of the LV API is checked at most once per
+const upstreamCheckInterval = 30 * time.Second
+
+// A Readiness tracks whether lvtracker is ready to serve requests, which it is while it is not
+// shutting down and the LV API was reachable at the last check.
+type Readiness struct {
+	mu           sync.Mutex
+	shuttingDown bool
+	checking     bool // Whether a check of the LV API is in progress
+	checkedAt    time.Time
+	upstreamErr  error
+}
+
+// A ReadinessStatus represents the readiness reported by /readyz.
+type ReadinessStatus struct {
+	Ready        bool      `json:"Ready"`           // Whether requests should be routed to this instance
+	ShuttingDown bool      `json:"ShuttingDown"`    // Whether the server is draining before exit
+	Upstream     string    `json:"Upstream"`        // LV API reachability, reachable, unreachable or unknown until the first check
+	Error        string    `json:"Error,omitempty"` // Reason the LV API is unreachable
+	CheckedAt    time.Time `json:"CheckedAt"`       // Time the LV API was last checked
+}
+
+// Readiness reported by /readyz
+var readiness = &Readiness{}
+
+// SetShuttingDown marks lvtracker as shutting down so it is no longer reported ready.
+func (r *Readiness) SetShuttingDown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shuttingDown = true
+}
+
+// Status checks the reachability of the LV API if the last check is older than
+// upstreamCheckInterval, so frequent probes don't hit the API each time. The check runs without
+// holding the lock, and probes arriving meanwhile are answered with the result of the last check.
+// It returns the current readiness.
+func (r *Readiness) Status(ctx context.Context) ReadinessStatus {
+	r.mu.Lock()
+	check := !r.shuttingDown && !r.checking && time.Since(r.checkedAt) >= upstreamCheckInterval
+	if check {
+		r.checking = true
+	}
+	r.mu.Unlock()
+	if check {
+		// The probe that triggered the check may go away, the result serves later probes too, so
+		// the check only keeps the request ID and span of its context
+		pingCtx := lvapi.WithRequestID(context.Background(), lvapi.RequestID(ctx))
+		err := lvapi.PingUpstream(trace.ContextWithSpan(pingCtx, trace.SpanFromContext(ctx)))
+		if err != nil {
+			lvapi.Warn(ctx, "LV API unreachable", lvapi.F("error", err))
+		}
+		r.mu.Lock()
+		r.upstreamErr, r.checkedAt, r.checking = err, time.Now(), false
+		r.mu.Unlock()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := ReadinessStatus{ShuttingDown: r.shuttingDown, Upstream: "reachable", CheckedAt: r.checkedAt}
+	if r.upstreamErr != nil {
+		status.Upstream = "unreachable"
+		status.Error = r.upstreamErr.Error()
+	} else if r.checkedAt.IsZero() {
+		status.Upstream = "unknown"
+	}
+	status.Ready = !status.ShuttingDown && status.Upstream == "reachable"
+	return status
+}
+
+// returnLiveness reports that the process is up and serving requests.
+func returnLiveness(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// returnReadiness reports the readiness of lvtracker, with status 503 when it is not ready.
+func returnReadiness(w http.ResponseWriter, r *http.Request) {
+	status := readiness.Status(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/lvapi"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A PriceRecord represents the price of a product sku in a region from the moment it was first observed.
+type PriceRecord struct {
+	Sku      string    `json:"Sku"`      // Product identifier
+	Region   string    `json:"Region"`   // Region code the price was fetched from
+	Price    float64   `json:"Price"`    // Product price
+	Currency string    `json:"Currency"` // Product price currency code
+	Time     time.Time `json:"Time"`     // Time the price was first observed
+}
+
+// An AvailabilityRecord represents the availability of a product sku in a region from the moment it was first observed.
+type AvailabilityRecord struct {
+	Sku       string    `json:"Sku"`       // Product identifier
+	Region    string    `json:"Region"`    // Region code the availability was fetched from
+	Available bool      `json:"Available"` // Product availability
+	Time      time.Time `json:"Time"`      // Time the availability was first observed
+}
+
+// Time changes to the history are batched for before the store is persisted
+const historySaveDelay = 2 * time.Second
+
+// A HistoryStore holds the price and availability history of every fetched product sku.
+// Only changes are recorded, so each record is valid until the next record for the same sku and region.
+// If path is set, the store is persisted as JSON shortly after changes, batching changes made
+// meanwhile, and on Flush.
+type HistoryStore struct {
+	mu           sync.Mutex
+	saveMu       sync.Mutex // Held while the store is persisted, so snapshots are written in order
+	path         string
+	saveTimer    *time.Timer                     // Pending save, nil if there is none
+	Prices       map[string][]PriceRecord        `json:"Prices"`       // Price records keyed by sku
+	Availability map[string][]AvailabilityRecord `json:"Availability"` // Availability records keyed by sku
+}
+
+// NewHistoryStore creates a HistoryStore persisted at path.
+// Any history already saved at path is loaded. An empty path keeps the history in memory only.
+// It returns the created HistoryStore.
+func NewHistoryStore(path string) *HistoryStore {
+	h := &HistoryStore{
+		path:         path,
+		Prices:       make(map[string][]PriceRecord),
+		Availability: make(map[string][]AvailabilityRecord),
+	}
+	if path == "" {
+		return h
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lvapi.Error(context.Background(), "unable to read history", lvapi.F("path", path), lvapi.F("error", err))
+		}
+		return h
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		lvapi.Error(context.Background(), "unable to parse history", lvapi.F("path", path), lvapi.F("error", err))
+	}
+	if h.Prices == nil {
+		h.Prices = make(map[string][]PriceRecord)
+	}
+	if h.Availability == nil {
+		h.Availability = make(map[string][]AvailabilityRecord)
+	}
+	return h
+}
+
+// RecordPrice adds a price record for sku in region if the price differs from the last recorded one.
+// It returns the previous record and whether there was one, so the caller can detect price changes.
+func (h *HistoryStore) RecordPrice(sku string, region string, price float64, currency string) (PriceRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous, found := PriceRecord{}, false
+	for i := len(h.Prices[sku]) - 1; i >= 0; i-- {
+		if h.Prices[sku][i].Region == region {
+			previous, found = h.Prices[sku][i], true
+			break
+		}
+	}
+	if found && previous.Price == price && previous.Currency == currency {
+		return previous, found
+	}
+	record := PriceRecord{Sku: sku, Region: region, Price: price, Currency: currency, Time: time.Now()}
+	h.Prices[sku] = append(h.Prices[sku], record)
+	h.save()
+	return previous, found
+}
+
+// RecordAvailability adds an availability record for sku in region if the availability differs from the last recorded one.
+// It returns the previous record and whether there was one, so the caller can detect restocks.
+func (h *HistoryStore) RecordAvailability(sku string, region string, available bool) (AvailabilityRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous, found := AvailabilityRecord{}, false
+	for i := len(h.Availability[sku]) - 1; i >= 0; i-- {
+		if h.Availability[sku][i].Region == region {
+			previous, found = h.Availability[sku][i], true
+			break
+		}
+	}
+	if found && previous.Available == available {
+		return previous, found
+	}
+	record := AvailabilityRecord{Sku: sku, Region: region, Available: available, Time: time.Now()}
+	h.Availability[sku] = append(h.Availability[sku], record)
+	h.save()
+	return previous, found
+}
+
+// PriceHistory returns the price records for sku, oldest first.
+// If region is not empty only records from region are returned.
+func (h *HistoryStore) PriceHistory(sku string, region string) []PriceRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := []PriceRecord{}
+	for _, record := range h.Prices[sku] {
+		if region == "" || record.Region == region {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// AvailabilityHistory returns the availability records for sku, oldest first.
+// If region is not empty only records from region are returned.
+func (h *HistoryStore) AvailabilityHistory(sku string, region string) []AvailabilityRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := []AvailabilityRecord{}
+	for _, record := range h.Availability[sku] {
+		if region == "" || record.Region == region {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// AvailabilitySkus returns every sku with recorded availability, sorted.
+func (h *HistoryStore) AvailabilitySkus() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	skus := make([]string, 0, len(h.Availability))
+	for sku := range h.Availability {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	return skus
+}
+
+// MergeAvailability merges records into the availability history. Records of a sku and region
+// are ordered by time and only those changing the availability are kept, so a record at the
+// same time and with the same availability as a recorded one is left out, and a recorded one
+// may be dropped if an imported record now precedes it with the same availability.
+// With dryRun set the history is not changed.
+// It returns the number of records added and left out, or that would be.
+func (h *HistoryStore) MergeAvailability(records []AvailabilityRecord, dryRun bool) (added int, unchanged int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	imported := make(map[string][]AvailabilityRecord)
+	for _, record := range records {
+		imported[record.Sku] = append(imported[record.Sku], record)
+	}
+	merged := make(map[string][]AvailabilityRecord)
+	for sku, records := range imported {
+		type mergedRecord struct {
+			AvailabilityRecord
+			imported bool
+		}
+		// Recorded records come first so they win ties with imported ones
+		all := []mergedRecord{}
+		for _, record := range h.Availability[sku] {
+			all = append(all, mergedRecord{record, false})
+		}
+		for _, record := range records {
+			all = append(all, mergedRecord{record, true})
+		}
+		sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+		last := make(map[string]AvailabilityRecord)
+		kept := []AvailabilityRecord{}
+		for _, record := range all {
+			previous, found := last[record.Region]
+			if found && (previous.Available == record.Available || previous.Time.Equal(record.Time)) {
+				if record.imported {
+					unchanged++
+				}
+				continue
+			}
+			last[record.Region] = record.AvailabilityRecord
+			kept = append(kept, record.AvailabilityRecord)
+		}
+		added += len(records)
+		merged[sku] = kept
+	}
+	added -= unchanged
+	if dryRun || added == 0 {
+		return added, unchanged
+	}
+	for sku, records := range merged {
+		h.Availability[sku] = records
+	}
+	h.save()
+	return added, unchanged
+}
+
+// save schedules the store to be persisted after historySaveDelay, unless a save is already
+// pending. The caller must hold h.mu.
+func (h *HistoryStore) save() {
+	if h.path == "" || h.saveTimer != nil {
+		return
+	}
+	h.saveTimer = time.AfterFunc(historySaveDelay, h.Flush)
+}
+
+// Flush persists the store to its path as JSON now if a save is pending. The snapshot is taken
+// under the lock and written through a temporary file outside it, so recording doesn't wait on disk.
+func (h *HistoryStore) Flush() {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+	h.mu.Lock()
+	if h.saveTimer == nil {
+		h.mu.Unlock()
+		return
+	}
+	h.saveTimer.Stop()
+	h.saveTimer = nil
+	data, err := json.Marshal(h)
+	h.mu.Unlock()
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to encode history", lvapi.F("error", err))
+		return
+	}
+	if err := writeFileAtomic(h.path, data, 0644); err != nil {
+		lvapi.Error(context.Background(), "unable to write history", lvapi.F("path", h.path), lvapi.F("error", err))
+	}
+}
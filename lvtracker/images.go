@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example.com/lvapi"
+	"fmt"
+	"github.com/gorilla/mux"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Time after which the image URLs of a product are fetched again. Images already downloaded
+// are not downloaded again.
+const imageRefreshInterval = 24 * time.Hour
+
+// Quality of the JPEG thumbnails
+const thumbnailQuality = 80
+
+// Largest image, in pixels, decoded to generate a thumbnail. Decoding needs four bytes per pixel,
+// so larger images are served without thumbnail.
+const maxThumbnailSourcePixels = 25 * 1000 * 1000
+
+// Most image and thumbnail content kept by an ImageStore without directory, in bytes. The oldest
+// images are dropped beyond it and downloaded again when requested.
+const maxMemoryImageBytes = 64 << 20
+
+// A StoredImage represents an image downloaded from the LV CDN, stored once per content hash.
+type StoredImage struct {
+	Hash        string `json:"Hash"`        // SHA-256 of the image content
+	SourceURL   string `json:"SourceURL"`   // URL the image was first downloaded from
+	ContentType string `json:"ContentType"` // Media type of the image
+	Width       int    `json:"Width"`       // Width in pixels, zero if the image could not be decoded
+	Height      int    `json:"Height"`      // Height in pixels, zero if the image could not be decoded
+	Thumbnail   bool   `json:"Thumbnail"`   // Whether a thumbnail was generated
+}
+
+// An ImageResult represents an image of a product served by lvtracker.
+type ImageResult struct {
+	StoredImage
+	URL          string `json:"URL"`          // Path of the image
+	ThumbnailURL string `json:"ThumbnailURL"` // Path of the thumbnail, the image itself if it has none
+}
+
+// An ImageStore keeps the product images downloaded from the LV CDN with a thumbnail of each,
+// so clients don't hot-link the CDN. Images are stored once per content hash however many
+// products or URLs share them. If dir is set, images are written to dir and the index is
+// persisted as JSON after every change, otherwise everything is kept in memory, up to
+// maxMemoryImageBytes of content.
+type ImageStore struct {
+	mu       sync.Mutex
+	dir      string
+	data     map[string][]byte        // Image and thumbnail content keyed by file name, if dir is empty
+	dataSize int                      // Size of data in bytes
+	order    []string                 // Hashes of the images in data, oldest first
+	fetching map[string]chan struct{} // Closed when the fetch of the images of a sku completes
+	Images   map[string]StoredImage   `json:"Images"`   // Images keyed by hash
+	Products map[string][]string      `json:"Products"` // Image hashes keyed by sku
+	Fetched  map[string]time.Time     `json:"Fetched"`  // Time the image URLs of a sku were last fetched
+	Sources  map[string]string        `json:"Sources"`  // Image hashes keyed by the URL they were downloaded from
+}
+
+// Store of product images served by /api/v1/images
+var imageStore *ImageStore
+
+// NewImageStore creates an ImageStore keeping images in dir.
+// Any index already saved in dir is loaded. An empty dir keeps the images in memory only.
+// It returns the created ImageStore.
+func NewImageStore(dir string) *ImageStore {
+	s := &ImageStore{
+		dir:      dir,
+		data:     make(map[string][]byte),
+		fetching: make(map[string]chan struct{}),
+		Images:   make(map[string]StoredImage),
+		Products: make(map[string][]string),
+		Fetched:  make(map[string]time.Time),
+		Sources:  make(map[string]string),
+	}
+	if dir == "" {
+		return s
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		lvapi.Error(context.Background(), "unable to create image directory", lvapi.F("path", dir), lvapi.F("error", err))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lvapi.Error(context.Background(), "unable to read image index", lvapi.F("path", dir), lvapi.F("error", err))
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		lvapi.Error(context.Background(), "unable to parse image index", lvapi.F("path", dir), lvapi.F("error", err))
+	}
+	if s.Images == nil {
+		s.Images = make(map[string]StoredImage)
+	}
+	if s.Products == nil {
+		s.Products = make(map[string][]string)
+	}
+	if s.Fetched == nil {
+		s.Fetched = make(map[string]time.Time)
+	}
+	if s.Sources == nil {
+		s.Sources = make(map[string]string)
+	}
+	return s
+}
+
+// save writes the index to dir. The caller must hold s.mu.
+func (s *ImageStore) save() {
+	if s.dir == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to encode image index", lvapi.F("error", err))
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, "index.json"), data, 0644); err != nil {
+		lvapi.Error(context.Background(), "unable to save image index", lvapi.F("path", s.dir), lvapi.F("error", err))
+	}
+}
+
+// write stores content under name. The caller must hold s.mu.
+func (s *ImageStore) write(name string, content []byte) error {
+	if s.dir == "" {
+		s.dataSize += len(content) - len(s.data[name])
+		s.data[name] = content
+		return nil
+	}
+	return writeFileAtomic(filepath.Join(s.dir, name), content, 0644)
+}
+
+// evict drops the oldest images kept in memory until their content fits in maxMemoryImageBytes.
+// Products that lose an image are fetched again when their images are requested.
+// The caller must hold s.mu.
+func (s *ImageStore) evict() {
+	for s.dataSize > maxMemoryImageBytes && len(s.order) > 1 {
+		hash := s.order[0]
+		s.order = s.order[1:]
+		stored := s.Images[hash]
+		for _, name := range []string{imageFileName(hash, stored.ContentType), thumbnailFileName(hash)} {
+			s.dataSize -= len(s.data[name])
+			delete(s.data, name)
+		}
+		delete(s.Images, hash)
+		for url, source := range s.Sources {
+			if source == hash {
+				delete(s.Sources, url)
+			}
+		}
+		for sku, hashes := range s.Products {
+			kept := hashes[:0]
+			for _, linked := range hashes {
+				if linked != hash {
+					kept = append(kept, linked)
+				}
+			}
+			if len(kept) == len(hashes) {
+				continue
+			}
+			s.Products[sku] = kept
+			if len(kept) == 0 {
+				delete(s.Products, sku)
+			}
+			delete(s.Fetched, sku)
+		}
+	}
+}
+
+// read returns the content stored under name.
+func (s *ImageStore) read(name string) ([]byte, error) {
+	if s.dir == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		content, found := s.data[name]
+		if !found {
+			return nil, os.ErrNotExist
+		}
+		return content, nil
+	}
+	return ioutil.ReadFile(filepath.Join(s.dir, name))
+}
+
+// imageFileName returns the name an image with hash and contentType is stored under.
+func imageFileName(hash string, contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return hash + ".jpg"
+	case "image/png":
+		return hash + ".png"
+	case "image/gif":
+		return hash + ".gif"
+	case "image/webp":
+		return hash + ".webp"
+	}
+	return hash + ".img"
+}
+
+// thumbnailFileName returns the name the thumbnail of the image with hash is stored under.
+func thumbnailFileName(hash string) string {
+	return hash + ".thumb.jpg"
+}
+
+// Store adds the image at url to the images of sku. An image already downloaded from url is
+// not downloaded again, and an image with the same content as a stored one is not stored again.
+// It returns the stored image, or the error of lvapi.DownloadImage.
+func (s *ImageStore) Store(ctx context.Context, sku string, url string) (StoredImage, error) {
+	s.mu.Lock()
+	if hash, found := s.Sources[url]; found {
+		defer s.mu.Unlock()
+		if s.link(sku, hash) {
+			s.save()
+		}
+		return s.Images[hash], nil
+	}
+	s.mu.Unlock()
+	downloaded, err := lvapi.DownloadImage(ctx, url)
+	if err != nil {
+		return StoredImage{}, err
+	}
+	sum := sha256.Sum256(downloaded.Data)
+	stored := StoredImage{Hash: hex.EncodeToString(sum[:]), SourceURL: url, ContentType: downloaded.ContentType}
+	// Images the standard library cannot decode, such as WebP, are served without thumbnail, and
+	// so are images too large to decode safely, checked from their header before decoding
+	var thumbnail bytes.Buffer
+	header, _, err := image.DecodeConfig(bytes.NewReader(downloaded.Data))
+	if err == nil {
+		stored.Width, stored.Height = header.Width, header.Height
+		if header.Width*header.Height > maxThumbnailSourcePixels {
+			err = fmt.Errorf("%dx%d pixels is more than %d", header.Width, header.Height, maxThumbnailSourcePixels)
+		}
+	}
+	var decoded image.Image
+	if err == nil {
+		decoded, _, err = image.Decode(bytes.NewReader(downloaded.Data))
+	}
+	if err == nil {
+		stored.Thumbnail = jpeg.Encode(&thumbnail, resizeToFit(decoded, currentConfig().ThumbnailSize), &jpeg.Options{Quality: thumbnailQuality}) == nil
+	} else {
+		lvapi.Warn(ctx, "unable to decode image, serving it without thumbnail", lvapi.F("url", url), lvapi.F("error", err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, found := s.Images[stored.Hash]; found {
+		stored = existing
+	} else {
+		if err := s.write(imageFileName(stored.Hash, stored.ContentType), downloaded.Data); err != nil {
+			lvapi.Error(ctx, "unable to save image", lvapi.F("url", url), lvapi.F("error", err))
+			return StoredImage{}, err
+		}
+		if stored.Thumbnail {
+			if err := s.write(thumbnailFileName(stored.Hash), thumbnail.Bytes()); err != nil {
+				lvapi.Error(ctx, "unable to save thumbnail", lvapi.F("url", url), lvapi.F("error", err))
+				stored.Thumbnail = false
+			}
+		}
+		s.Images[stored.Hash] = stored
+		if s.dir == "" {
+			s.order = append(s.order, stored.Hash)
+		}
+	}
+	s.Sources[url] = stored.Hash
+	s.link(sku, stored.Hash)
+	s.evict()
+	s.save()
+	return stored, nil
+}
+
+// link adds the image with hash to the images of sku, unless it is already one of them.
+// It returns whether it was added. The caller must hold s.mu.
+func (s *ImageStore) link(sku string, hash string) bool {
+	for _, linked := range s.Products[sku] {
+		if linked == hash {
+			return false
+		}
+	}
+	s.Products[sku] = append(s.Products[sku], hash)
+	return true
+}
+
+// ProductImages returns the stored images of sku, first fetching the image URLs of sku in region from
+// the LV API if they were never fetched or are older than imageRefreshInterval. Concurrent calls
+// for the same sku share one fetch. Images that fail to download are skipped.
+// It returns the error of lvapi.GetLVProductImageURLsBySKU if no image of sku is stored.
+func (s *ImageStore) ProductImages(ctx context.Context, sku string, region string) ([]StoredImage, error) {
+	s.mu.Lock()
+	fetched, found := s.Fetched[sku]
+	if found && time.Since(fetched) < imageRefreshInterval {
+		defer s.mu.Unlock()
+		return s.stored(sku), nil
+	}
+	if done, fetching := s.fetching[sku]; fetching {
+		s.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.stored(sku), nil
+	}
+	done := make(chan struct{})
+	s.fetching[sku] = done
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.fetching, sku)
+		s.mu.Unlock()
+		close(done)
+	}()
+	urls, err := lvapi.GetLVProductImageURLsBySKU(ctx, sku, region)
+	if err == nil {
+		for _, url := range urls {
+			s.Store(ctx, sku, url)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && len(s.Products[sku]) == 0 {
+		return nil, err
+	}
+	if err == nil {
+		s.Fetched[sku] = time.Now()
+		s.save()
+	}
+	return s.stored(sku), nil
+}
+
+// stored returns the images of sku. The caller must hold s.mu.
+func (s *ImageStore) stored(sku string) []StoredImage {
+	images := []StoredImage{}
+	for _, hash := range s.Products[sku] {
+		images = append(images, s.Images[hash])
+	}
+	return images
+}
+
+// StoreListed stores the image of every product of routes found in images, matched by product
+// name as they are listed on the same subcategory page. Images already downloaded are skipped.
+func (s *ImageStore) StoreListed(ctx context.Context, routes []lvapi.ProductRoute, images []lvapi.ProductImage) {
+	urls := make(map[string]string)
+	for _, image := range images {
+		urls[image.Name] = image.URL
+	}
+	for _, route := range routes {
+		sku, url := skuFromRoute(route.Route), urls[route.Name]
+		if sku == "" || url == "" || ctx.Err() != nil {
+			continue
+		}
+		if _, err := s.Store(ctx, sku, url); err != nil {
+			lvapi.Warn(ctx, "unable to store product image", lvapi.F("sku", sku), lvapi.F("url", url), lvapi.F("error", err))
+		}
+	}
+}
+
+// ThumbnailURL returns the path of the thumbnail of the first stored image of sku and whether
+// sku has a stored image.
+func (s *ImageStore) ThumbnailURL(sku string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.Products[sku]) == 0 {
+		return "", false
+	}
+	return imageResult(sku, s.Images[s.Products[sku][0]]).ThumbnailURL, true
+}
+
+// image returns the stored image of sku with hash and whether sku has it.
+func (s *ImageStore) image(sku string, hash string) (StoredImage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, linked := range s.Products[sku] {
+		if linked == hash {
+			return s.Images[hash], true
+		}
+	}
+	return StoredImage{}, false
+}
+
+// imageResult returns stored with the paths it is served at for sku.
+func imageResult(sku string, stored StoredImage) ImageResult {
+	result := ImageResult{StoredImage: stored, URL: apiPrefix + "/images/" + sku + "/" + stored.Hash}
+	result.ThumbnailURL = result.URL
+	if stored.Thumbnail {
+		result.ThumbnailURL += "/thumbnail"
+	}
+	return result
+}
+
+// resizeToFit returns img scaled down to fit a size by size square, keeping its aspect ratio,
+// each pixel averaging the pixels of img it covers. Images that already fit are returned as is.
+func resizeToFit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	targetWidth, targetHeight := size, height*size/width
+	if height > width {
+		targetWidth, targetHeight = width*size/height, size
+	}
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+	if targetHeight < 1 {
+		targetHeight = 1
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	for y := 0; y < targetHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/targetHeight, bounds.Min.Y+(y+1)*height/targetHeight
+		for x := 0; x < targetWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/targetWidth, bounds.Min.X+(x+1)*width/targetWidth
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			offset := resized.PixOffset(x, y)
+			resized.Pix[offset] = uint8(r / n >> 8)
+			resized.Pix[offset+1] = uint8(g / n >> 8)
+			resized.Pix[offset+2] = uint8(b / n >> 8)
+			resized.Pix[offset+3] = uint8(a / n >> 8)
+		}
+	}
+	return resized
+}
+
+func returnItemImages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	images, err := imageStore.ProductImages(r.Context(), vars["sku"], region)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	results := []ImageResult{}
+	for _, stored := range images {
+		results = append(results, imageResult(vars["sku"], stored))
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+func returnImage(w http.ResponseWriter, r *http.Request) {
+	serveStoredImage(w, r, false)
+}
+
+func returnImageThumbnail(w http.ResponseWriter, r *http.Request) {
+	serveStoredImage(w, r, true)
+}
+
+// serveStoredImage writes the image, or its thumbnail, named by the sku and hash route variables.
+// The content of a hash never changes, so it is cached for a year.
+func serveStoredImage(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	vars := mux.Vars(r)
+	stored, found := imageStore.image(vars["sku"], vars["hash"])
+	if !found {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown image: "+vars["hash"], false)
+		return
+	}
+	name, contentType := imageFileName(stored.Hash, stored.ContentType), stored.ContentType
+	if thumbnail && stored.Thumbnail {
+		name, contentType = thumbnailFileName(stored.Hash), "image/jpeg"
+	}
+	content, err := imageStore.read(name)
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown image: "+vars["hash"], false)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeUnavailable, "Unable to read image", true)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+name+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
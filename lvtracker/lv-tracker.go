@@ -1,39 +1,387 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"example.com/lvapi"
+	"flag"
 	"fmt"
 	"github.com/gorilla/mux"
-	"log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Region time zones must resolve on hosts without a time zone database
+	_ "time/tzdata"
 )
 
-func homePage(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Welcome to the HomePage!")
-	fmt.Println("Endpoint Hit: homePage")
+// Price and availability history of every fetched SKU
+var history *HistoryStore
+
+// Notifier for changes to tracked SKUs
+var notifier *Notifier
+
+// Entries polled for availability in the background
+var watchlist *Watchlist
+
+// Product family graphs keyed by region and sku
+var familyCache *Cache
+
+// In-store availability keyed by region, sku and location
+var storeCache *Cache
+
+// Region codes and store URLs crawled from the LV website
+var regionCache *Cache
+
+// Crawler reporting new, removed and renamed products in watched subcategories
+var catalogWatcher *CatalogWatcher
+
+// recordProduct records the availability and price of product in region into the history store.
+// A restock notification is sent when a previously unavailable product becomes available, and
+// a price change notification when the price moves by more than the configured price threshold percent.
+// The product is indexed for search by its SKU.
+func recordProduct(ctx context.Context, product lvapi.ProductAvailability, region string) {
+	searchIndex.IndexSku(product.Sku)
+	previousAvailability, found := history.RecordAvailability(product.Sku, region, product.Available)
+	if found && !previousAvailability.Available && product.Available {
+		notifier.Notify(ctx, Event{Type: EventRestock, Sku: product.Sku, Region: region, Message: "back in stock"})
+	}
+	if product.Price <= 0 {
+		return
+	}
+	previous, found := history.RecordPrice(product.Sku, region, product.Price, product.Currency)
+	if !found || previous.Currency != product.Currency || previous.Price == product.Price {
+		return
+	}
+	change := (product.Price - previous.Price) / previous.Price * 100
+	if math.Abs(change) > currentConfig().PriceThreshold {
+		notifier.Notify(ctx, Event{
+			Type:    EventPriceChange,
+			Sku:     product.Sku,
+			Region:  region,
+			Message: fmt.Sprintf("price changed from %.2f to %.2f %s (%+.1f%%)", previous.Price, product.Price, product.Currency, change),
+		})
+	}
 }
 
 func returnItemFamily(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	fmt.Println("Endpoint Hit: Item Family for SKU: " + vars["sku"])
-	json.NewEncoder(w).Encode(lvapi.GetLVAlternativeStyleProductIndentifierAndAvailabilityForSKU(vars["sku"]))
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	products, err := lvapi.FetchLVAlternativeStyleAvailability(r.Context(), vars["sku"], region)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	for _, product := range products {
+		recordProduct(r.Context(), product, region)
+	}
+	json.NewEncoder(w).Encode(products)
 }
 
 func returnItem(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	fmt.Println("Endpoint Hit: Item Family for SKU: " + vars["sku"])
-	json.NewEncoder(w).Encode(lvapi.GetLVProductAvailabilityBySKU(vars["sku"]))
+	region := currentConfig().Region
+	product, err := lvapi.FetchLVProductAvailability(r.Context(), vars["sku"], region)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	recordProduct(r.Context(), product, region)
+	json.NewEncoder(w).Encode(product)
+}
+
+func returnItemPrices(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p := requestPrincipal(r)
+	if !p.views(vars["sku"], r.URL.Query().Get("region")) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "SKU not watched by the workspace: "+vars["sku"], false)
+		return
+	}
+	prices := []PriceRecord{}
+	for _, record := range history.PriceHistory(vars["sku"], r.URL.Query().Get("region")) {
+		if p.views(record.Sku, record.Region) {
+			prices = append(prices, record)
+		}
+	}
+	json.NewEncoder(w).Encode(prices)
+}
+
+func returnItemPriceComparison(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	exchangeRates := currentConfig().exchangeRates
+	if exchangeRates == nil {
+		writeError(w, http.StatusServiceUnavailable, CodeUnavailable, "No exchange rate table loaded", false)
+		return
+	}
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		currency = exchangeRates.Base
+	}
+	if _, ok := exchangeRates.Convert(1, currency, exchangeRates.Base); !ok {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Unknown currency: "+currency, false)
+		return
+	}
+	excludeVAT := r.URL.Query().Get("vat") == "exclusive"
+	prices := lvapi.CompareLVProductPricesAcrossRegions(r.Context(), vars["sku"], currency, *exchangeRates, excludeVAT)
+	for _, price := range prices {
+		recordProduct(r.Context(), lvapi.ProductAvailability{Sku: price.Sku, Available: price.Available, Price: price.Price, Currency: price.Currency}, price.Region)
+	}
+	json.NewEncoder(w).Encode(prices)
+}
+
+func returnItemVariants(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	variants, err := lvapi.FetchLVProductVariants(r.Context(), vars["sku"], region)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	for _, variant := range variants {
+		recordProduct(r.Context(), lvapi.ProductAvailability{Sku: variant.Sku, Available: variant.Available, Price: variant.Price, Currency: variant.Currency}, region)
+	}
+	json.NewEncoder(w).Encode(variants)
+}
+
+func returnFamily(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	if family, found := familyCache.Get(region + "/" + vars["sku"]); found {
+		json.NewEncoder(w).Encode(family)
+		return
+	}
+	family, err := lvapi.FetchLVProductFamily(r.Context(), vars["sku"], region)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	// Every member of the family shares the same graph
+	for _, variant := range family.Variants {
+		recordProduct(r.Context(), lvapi.ProductAvailability{Sku: variant.Sku, Available: variant.Available, Price: variant.Price, Currency: variant.Currency}, region)
+		familyCache.Set(region+"/"+variant.Sku, family)
+	}
+	familyCache.Set(region+"/"+vars["sku"], family)
+	json.NewEncoder(w).Encode(family)
+}
+
+func returnItemStores(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	region := query.Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	var key string
+	var stores func() ([]lvapi.Store, error)
+	if query.Get("lat") != "" || query.Get("lng") != "" {
+		lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+		if latErr != nil || lngErr != nil || math.Abs(lat) > 90 || math.Abs(lng) > 180 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "lat and lng must be valid coordinates", false)
+			return
+		}
+		// Round to about a kilometre so nearby searches share cached results
+		key = fmt.Sprintf("%s/%s/%.2f,%.2f", region, vars["sku"], lat, lng)
+		stores = func() ([]lvapi.Store, error) { return lvapi.GetLVStoresNear(r.Context(), lat, lng, region) }
+	} else if city := query.Get("city"); city != "" {
+		key = region + "/" + vars["sku"] + "/" + strings.ToLower(city)
+		stores = func() ([]lvapi.Store, error) { return lvapi.GetLVStoresInCity(r.Context(), city, region) }
+	} else {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "lat and lng or city are required", false)
+		return
+	}
+	if availability, found := storeCache.Get(key); found {
+		json.NewEncoder(w).Encode(availability)
+		return
+	}
+	found, err := stores()
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	availability, err := lvapi.GetLVStoreAvailabilityBySKU(r.Context(), vars["sku"], region, found)
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	// Only successful lookups are cached, a failed one is retried by the next request
+	storeCache.Set(key, availability)
+	json.NewEncoder(w).Encode(availability)
+}
+
+// regionURLs returns the region codes and store URLs of the LV website, crawled at most once
+// per cache time to live.
+func regionURLs(ctx context.Context) []lvapi.RegionURL {
+	if regions, found := regionCache.Get("all"); found {
+		return regions.([]lvapi.RegionURL)
+	}
+	regions := lvapi.GetLVRegionCodesAndURLs(ctx)
+	// Don't cache a failed crawl
+	if len(regions) > 0 {
+		regionCache.Set("all", regions)
+	}
+	return regions
+}
+
+func returnItemLinks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pages, err := lvapi.GetLVProductPagesBySKU(r.Context(), vars["sku"], regionURLs(r.Context()))
+	if err != nil {
+		writeLVAPIError(w, r, err)
+		return
+	}
+	// Only link to the store of the requested region
+	if region := r.URL.Query().Get("region"); region != "" {
+		for i, page := range pages {
+			links := []lvapi.ProductLink{}
+			for _, link := range page.Links {
+				if link.Region == region {
+					links = append(links, link)
+				}
+			}
+			pages[i].Links = links
+		}
+	}
+	json.NewEncoder(w).Encode(pages)
+}
+
+func returnWatchlist(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(requestPrincipal(r).watchlist().List())
+}
+
+func addWatchEntry(w http.ResponseWriter, r *http.Request) {
+	var entry WatchEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil || entry.Sku == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Watchlist entry requires a Sku", false)
+		return
+	}
+	if err := lvapi.ValidateSKU(entry.Sku); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidSKU, "Malformed SKU: "+entry.Sku, false)
+		return
+	}
+	if err := entry.Schedule.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error(), false)
+		return
+	}
+	// The watchlist poller checks the new entry right away
+	entry = requestPrincipal(r).watchlist().Add(entry)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+func removeWatchEntry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil || !requestPrincipal(r).watchlist().Remove(id) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown watchlist entry: "+vars["id"], false)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func returnCatalogEvents(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "since must be an RFC 3339 time", false)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(catalogWatcher.Events(since))
 }
 
 func handleRequests() {
 	r := mux.NewRouter().StrictSlash(true)
-	r.HandleFunc("/", homePage)
-	r.HandleFunc("/api/itemfamily/{sku}", returnItemFamily)
-	r.HandleFunc("/api/item/{sku}", returnItem)
-	log.Fatal(http.ListenAndServe(":8080", r))
+	r.NotFoundHandler = http.HandlerFunc(returnNotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(returnMethodNotAllowed)
+	r.Use(requestLogger, routeMetrics, traceRoutes)
+	r.Handle("/metrics", promhttp.Handler())
+	r.HandleFunc("/healthz", returnLiveness)
+	r.HandleFunc("/readyz", returnReadiness)
+	r.HandleFunc(apiPrefix+"/openapi.json", returnOpenAPISpec).Methods("GET")
+	for _, route := range apiRoutes {
+		handler := validateSKU(requireRole(route.Role, route.Handler))
+		if route.Streamed {
+			handler = streamed(handler)
+		}
+		r.HandleFunc(apiPrefix+route.Path, handler).Methods(route.Method)
+		// Unversioned paths predating /api/v1, kept for existing clients
+		r.HandleFunc("/api"+route.Path, deprecated(handler)).Methods(route.Method)
+	}
+	client, err := newStaticHandler(webRoot())
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to load embedded client", lvapi.F("error", err))
+		os.Exit(1)
+	}
+	// The client is served at / and every path not matched by the API
+	r.PathPrefix("/").Handler(client).Methods("GET", "HEAD")
+	err = serve(cors(r))
+	shutdownTracing(context.Background())
+	if err != nil {
+		lvapi.Error(context.Background(), "server stopped", lvapi.F("error", err))
+		os.Exit(1)
+	}
+	lvapi.Info(context.Background(), "server stopped")
 }
 
 func main() {
+	configPath := flag.String("config", os.Getenv(envPrefix+"CONFIG"), "YAML configuration file, settings in it are overridden by LVTRACKER_ environment variables and flags")
+	flagConfig := defaultConfig()
+	bindFlags(flag.CommandLine, &flagConfig)
+	flag.Parse()
+	// Flags set on the command line keep precedence over the configuration file on every reload
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	config, err := LoadConfig(*configPath, flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	applyConfig(config)
+
+	lvapi.SetObserver(metricsObserver{})
+	exporter, err := newTraceExporter(context.Background())
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to create trace exporter", lvapi.F("error", err))
+		os.Exit(1)
+	}
+	if exporter != nil {
+		shutdownTracing = setupTracing(exporter)
+	}
+	history = NewHistoryStore(config.HistoryPath)
+	for _, sku := range history.AvailabilitySkus() {
+		searchIndex.IndexSku(sku)
+	}
+	notifier = NewNotifier(config.Webhooks, config.SubscriptionsPath)
+	watchlist = NewWatchlist(config.WatchlistPath)
+	workspaces = NewWorkspaceStore(config.WorkspacesPath)
+	if config.AdminKey == "" && workspaces.Len() > 0 {
+		lvapi.Warn(context.Background(), "workspaces exist but no admin key is configured, requests without API key are refused")
+	}
+	imageStore = NewImageStore(config.ImagesPath)
+	familyCache = NewCache("family", config.CacheTTL)
+	storeCache = NewCache("stores", config.CacheTTL)
+	regionCache = NewCache("regions", config.CacheTTL)
+	runJob(pollWatchlist)
+	catalogWatcher = NewCatalogWatcher(config.CatalogSubcategories)
+	runJob(catalogWatcher.Run)
+	go reloadOnHangup(*configPath, flags)
 	handleRequests()
 }
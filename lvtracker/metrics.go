@@ -0,0 +1,93 @@
+package main
+
+import (
+	"example.com/lvapi"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	upstreamRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvapi_upstream_requests_total",
+		Help: "Requests made to LV endpoints by endpoint type, region and HTTP status, status 0 when no response was received. Regions neither configured nor listed on the LV landing page are labelled other.",
+	}, []string{"endpoint", "region", "status"})
+	upstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lvapi_upstream_request_duration_seconds",
+		Help:    "Latency of requests made to LV endpoints by endpoint type and region, other for regions neither configured nor listed on the LV landing page.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "region"})
+	parseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvapi_parse_failures_total",
+		Help: "LV endpoint responses that could not be parsed by endpoint type.",
+	}, []string{"endpoint"})
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvtracker_cache_lookups_total",
+		Help: "Cache lookups by cache and result, hit or miss.",
+	}, []string{"cache", "result"})
+	pollCycles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvtracker_poll_cycles_total",
+		Help: "Completed background poll cycles by poller, watchlist or catalog.",
+	}, []string{"poller"})
+	availabilityChecks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "lvtracker_watchlist_checks_total",
+		Help: "Watchlist entries checked for availability.",
+	})
+	notificationDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvtracker_notification_deliveries_total",
+		Help: "Webhook notification deliveries by event type and result, delivered or failed.",
+	}, []string{"type", "result"})
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lvtracker_http_requests_total",
+		Help: "HTTP requests served by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lvtracker_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests served by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(upstreamRequests, upstreamDuration, parseFailures, cacheLookups,
+		pollCycles, availabilityChecks, notificationDeliveries, httpRequests, httpDuration)
+}
+
+// Region label of upstream requests for a region neither configured nor listed on the LV landing page
+const otherRegion = "other"
+
+// A metricsObserver records lvapi requests into the upstream metrics.
+type metricsObserver struct{}
+
+func (metricsObserver) ObserveRequest(endpoint string, region string, status int, duration time.Duration) {
+	// Regions come from requests, so made up ones share a label rather than creating series each
+	if region != "" && region != currentConfig().Region && !lvapi.ListedRegion(region) {
+		region = otherRegion
+	}
+	upstreamRequests.WithLabelValues(endpoint, region, strconv.Itoa(status)).Inc()
+	upstreamDuration.WithLabelValues(endpoint, region).Observe(duration.Seconds())
+}
+
+func (metricsObserver) ObserveParseFailure(endpoint string) {
+	parseFailures.WithLabelValues(endpoint).Inc()
+}
+
+// routeMetrics records the HTTP server metrics of every request, labelled by route template
+// rather than path so SKUs don't create a series each.
+func routeMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"example.com/lvapi"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A statusRecorder records the status code written to a http.ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush passes flushes through so streamed responses are not buffered.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Context key of the connection a request was received on
+type connContextKey struct{}
+
+// withConn returns ctx carrying conn, for http.Server.ConnContext.
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// A streamWriter gives every write and flush of a streamed response its own write timeout.
+type streamWriter struct {
+	http.ResponseWriter
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	return s.ResponseWriter.Write(p)
+}
+
+// Flush passes flushes through so streamed responses are not buffered.
+func (s *streamWriter) Flush() {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// streamed exempts responses of next from the server write timeout, which would cut off
+// streamed and fanned out responses taking longer than it. The write timeout applies to each
+// write instead, so clients that stop reading are still disconnected. The server sets the
+// write deadline of the connection, carried by the request context, before calling handlers
+// and again for the next request on it, so it is moved for each write here.
+func streamed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := r.Context().Value(connContextKey{}).(net.Conn)
+		if !ok {
+			lvapi.Warn(r.Context(), "unable to lift write timeout, request has no connection")
+			next(w, r)
+			return
+		}
+		conn.SetWriteDeadline(time.Time{})
+		next(&streamWriter{ResponseWriter: w, conn: conn, timeout: currentConfig().WriteTimeout}, r)
+	}
+}
+
+// requestLogger assigns every request a request ID, taken from the X-Request-ID header if the
+// client sent one, and logs the request once it has been served.
+// The request ID is carried by the request context down into lvapi and echoed in the response.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(lvapi.RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = lvapi.NewRequestID()
+		}
+		ctx := lvapi.WithRequestID(r.Context(), id)
+		w.Header().Set(lvapi.RequestIDHeader, id)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		lvapi.Info(ctx, "request served",
+			lvapi.F("method", r.Method),
+			lvapi.F("path", r.URL.Path),
+			lvapi.F("status", recorder.status),
+			lvapi.F("duration_ms", time.Since(start).Milliseconds()))
+	})
+}
+
+// cors lets browsers on the configured origins call the API, answering preflight requests
+// itself so they are not rejected by routes restricted to other methods.
+// Requests from other origins are served without CORS headers, so browsers block their responses.
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := ""
+		for _, o := range currentConfig().CORSOrigins {
+			if o == "*" {
+				allowed = "*"
+				break
+			}
+			if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+				allowed = origin
+				break
+			}
+		}
+		if origin == "" || allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Access-Control-Expose-Headers", lvapi.RequestIDHeader)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, "+lvapi.RequestIDHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecated marks responses of next as deprecated in favour of the same path below apiPrefix.
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiPrefix+strings.TrimPrefix(r.URL.Path, "/api")+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"example.com/lvapi"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification event types
+const (
+	EventPriceChange = "price_change"
+	EventRestock     = "restock"
+
+	EventNewProduct     = "new_product"
+	EventRemovedProduct = "removed_product"
+	EventRenamedProduct = "renamed_product"
+)
+
+// An Event represents a change to a tracked product that subscribers are notified of.
+type Event struct {
+	Type    string    `json:"Type"`          // Event type
+	Sku     string    `json:"Sku"`           // Product identifier
+	Region  string    `json:"Region"`        // Region code the change was observed in
+	URL     string    `json:"URL,omitempty"` // Product page route, for catalog events
+	Message string    `json:"Message"`       // Human readable description of the change
+	Time    time.Time `json:"Time"`          // Time the change was observed
+}
+
+// A Notifier delivers events to the log and to every subscribed webhook URL: the webhooks of
+// the configuration and those subscribed at runtime, such as by an import.
+// If path is set, the webhooks subscribed at runtime are persisted as JSON after every change.
+type Notifier struct {
+	mu         sync.RWMutex
+	webhooks   []string
+	path       string
+	client     *http.Client
+	deliveries sync.WaitGroup
+	Subscribed []string `json:"Webhooks"` // Webhook URLs subscribed at runtime
+}
+
+// NewNotifier creates a Notifier posting events to webhooks and to the webhooks already
+// subscribed at path. An empty path keeps runtime subscriptions in memory only.
+// It returns the created Notifier.
+func NewNotifier(webhooks []string, path string) *Notifier {
+	transport := &http.Transport{DialContext: dialWebhook, TLSHandshakeTimeout: 10 * time.Second}
+	n := &Notifier{webhooks: webhooks, path: path, client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+	if path == "" {
+		return n
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lvapi.Error(context.Background(), "unable to read subscriptions", lvapi.F("path", path), lvapi.F("error", err))
+		}
+		return n
+	}
+	if err := json.Unmarshal(data, n); err != nil {
+		lvapi.Error(context.Background(), "unable to parse subscriptions", lvapi.F("path", path), lvapi.F("error", err))
+	}
+	return n
+}
+
+// Returned for webhook hosts resolving to private addresses that are not allowed
+var errPrivateWebhook = errors.New("resolves to a private, loopback or link-local address")
+
+// Private address ranges of RFC 1918 and RFC 4193
+var privateNetworks = parseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+// parseCIDRs returns the networks of cidrs, which must be valid.
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// isPrivateIP returns whether ip is in a private address range.
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookAddressAllowed returns whether webhooks may be delivered to ip of host: public addresses,
+// and private, loopback and link-local ones if host or a range containing ip is allowlisted.
+// Hosts of the configured webhooks are trusted like allowlisted ones.
+func webhookAddressAllowed(host string, ip net.IP) bool {
+	if !isPrivateIP(ip) && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified() {
+		return true
+	}
+	config := currentConfig()
+	for _, allowed := range config.WebhookAllowlist {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	for _, webhook := range config.Webhooks {
+		if u, err := url.Parse(webhook); err == nil && strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveWebhookHost returns the addresses of host, failing with errPrivateWebhook if any of them
+// is not allowed by webhookAddressAllowed.
+func resolveWebhookHost(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !webhookAddressAllowed(host, ip) {
+			return nil, errPrivateWebhook
+		}
+	}
+	return ips, nil
+}
+
+// checkWebhookURL returns why webhook can't be subscribed: it is not an absolute http or https
+// URL, or its host can't be resolved or resolves to an address that is not allowed.
+func checkWebhookURL(ctx context.Context, webhook string) error {
+	if !isHTTPURL(webhook) {
+		return fmt.Errorf("%q is not an http or https URL", webhook)
+	}
+	u, _ := url.Parse(webhook)
+	if _, err := resolveWebhookHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("%q: %w", webhook, err)
+	}
+	return nil
+}
+
+// dialWebhook connects to addr after checking its addresses, so webhook hosts can't be pointed
+// at private addresses after they were subscribed, nor redirect to them.
+func dialWebhook(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := resolveWebhookHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", host, err)
+	}
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// SetWebhooks replaces the configured webhook URLs events are posted to.
+func (n *Notifier) SetWebhooks(webhooks []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.webhooks = webhooks
+}
+
+// Webhooks returns every webhook URL events are posted to, configured ones first, without duplicates.
+func (n *Notifier) Webhooks() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.list()
+}
+
+// list returns every webhook URL without duplicates. The caller must hold n.mu.
+func (n *Notifier) list() []string {
+	webhooks := []string{}
+	seen := make(map[string]bool)
+	for _, webhook := range append(append([]string{}, n.webhooks...), n.Subscribed...) {
+		if !seen[webhook] {
+			seen[webhook] = true
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+// Subscribe subscribes every webhook URL of webhooks events are not posted to yet. With dryRun
+// set nothing is subscribed.
+// It returns the number of webhooks subscribed, or that would be, and of those already subscribed.
+func (n *Notifier) Subscribe(webhooks []string, dryRun bool) (added int, unchanged int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, webhook := range n.list() {
+		seen[webhook] = true
+	}
+	for _, webhook := range webhooks {
+		if seen[webhook] {
+			unchanged++
+			continue
+		}
+		seen[webhook] = true
+		added++
+		if !dryRun {
+			n.Subscribed = append(n.Subscribed, webhook)
+		}
+	}
+	if added > 0 && !dryRun {
+		n.save()
+	}
+	return added, unchanged
+}
+
+// save writes the webhooks subscribed at runtime to its path as JSON. The caller must hold n.mu.
+func (n *Notifier) save() {
+	if n.path == "" {
+		return
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to encode subscriptions", lvapi.F("error", err))
+		return
+	}
+	if err := writeFileAtomic(n.path, data, 0644); err != nil {
+		lvapi.Error(context.Background(), "unable to write subscriptions", lvapi.F("path", n.path), lvapi.F("error", err))
+	}
+}
+
+// Unsubscribe unsubscribes the webhook URL subscribed at runtime.
+// It returns false if webhook was not subscribed at runtime, such as a configured webhook.
+func (n *Notifier) Unsubscribe(webhook string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, subscribed := range n.Subscribed {
+		if subscribed == webhook {
+			n.Subscribed = append(n.Subscribed[:i], n.Subscribed[i+1:]...)
+			n.save()
+			return true
+		}
+	}
+	return false
+}
+
+// Notify logs event and posts it as JSON to every webhook in the background, and to the webhooks
+// of every workspace watching the product of the event in its region.
+func (n *Notifier) Notify(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	lvapi.Info(ctx, "notification", lvapi.F("type", event.Type), lvapi.F("sku", event.Sku), lvapi.F("region", event.Region), lvapi.F("message", event.Message))
+	body, err := json.Marshal(event)
+	if err != nil {
+		lvapi.Error(ctx, "unable to encode notification", lvapi.F("error", err))
+		return
+	}
+	webhooks := n.Webhooks()
+	if workspaces != nil {
+		seen := make(map[string]bool)
+		for _, webhook := range webhooks {
+			seen[webhook] = true
+		}
+		for _, webhook := range workspaces.WebhooksWatching(event.Sku, event.Region) {
+			if !seen[webhook] {
+				seen[webhook] = true
+				webhooks = append(webhooks, webhook)
+			}
+		}
+	}
+	for _, webhook := range webhooks {
+		n.deliveries.Add(1)
+		go func(url string) {
+			defer n.deliveries.Done()
+			resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				lvapi.Error(ctx, "webhook failed", lvapi.F("url", url), lvapi.F("error", err))
+				notificationDeliveries.WithLabelValues(event.Type, "failed").Inc()
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				lvapi.Error(ctx, "webhook failed", lvapi.F("url", url), lvapi.F("status", resp.StatusCode))
+				notificationDeliveries.WithLabelValues(event.Type, "failed").Inc()
+				return
+			}
+			notificationDeliveries.WithLabelValues(event.Type, "delivered").Inc()
+		}(webhook)
+	}
+}
+
+// Wait waits for every webhook delivery in progress to finish.
+func (n *Notifier) Wait() {
+	n.deliveries.Wait()
+}
+
+// A WebhookSubscription represents a webhook URL notified of events.
+type WebhookSubscription struct {
+	URL string `json:"URL"` // URL events are posted to as JSON
+}
+
+func returnWebhooks(w http.ResponseWriter, r *http.Request) {
+	subscriptions := []WebhookSubscription{}
+	for _, webhook := range requestPrincipal(r).subscriptions().Webhooks() {
+		subscriptions = append(subscriptions, WebhookSubscription{URL: webhook})
+	}
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func addWebhook(w http.ResponseWriter, r *http.Request) {
+	var subscription WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil || !isHTTPURL(subscription.URL) {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Webhook requires an http or https URL", false)
+		return
+	}
+	if err := checkWebhookURL(r.Context(), subscription.URL); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Webhook "+err.Error(), false)
+		return
+	}
+	requestPrincipal(r).subscriptions().Subscribe([]string{subscription.URL}, false)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func removeWebhook(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if !requestPrincipal(r).subscriptions().Unsubscribe(url) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Webhook not subscribed at runtime: "+url, false)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
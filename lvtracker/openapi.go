@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version of the API described by the OpenAPI spec
+const apiVersion = "1.0.0"
+
+// A schemaGenerator builds OpenAPI schemas from Go types, collecting named struct types
+// as components referenced by name.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// Types with a fixed schema instead of one derived from their fields
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// schema returns the schema of t. Struct types are added to the components and referenced.
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "description": "Duration in nanoseconds"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, found := g.components[t.Name()]; !found {
+			// Reserve the name first so recursive types terminate
+			g.components[t.Name()] = nil
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of the exported fields of struct type t, named by their
+// JSON tags. Fields without omitempty are required, as encoding/json always writes them.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, options := field.Name, ""
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if comma := strings.Index(tag, ","); comma >= 0 {
+				tag, options = tag[:comma], tag[comma:]
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, ",omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// buildOpenAPISpec returns the OpenAPI 3 document describing routes served below apiPrefix.
+func buildOpenAPISpec(routes []apiRoute) map[string]interface{} {
+	generator := &schemaGenerator{components: make(map[string]interface{})}
+	errorSchema := generator.schema(reflect.TypeOf(ErrorResponse{}))
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		operation := map[string]interface{}{"summary": route.Summary}
+		var parameters []interface{}
+		for _, parameter := range route.Parameters {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        parameter.Name,
+				"in":          parameter.In,
+				"description": parameter.Description,
+				"required":    parameter.In == "path",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if route.Role != "" {
+			operation["description"] = "Requires an API key granting the " + route.Role + " role, unless the request has no key while no admin key is configured and no workspace exists."
+			operation["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+		}
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": generator.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if route.Response != nil {
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			response["content"] = map[string]interface{}{
+				contentType: map[string]interface{}{"schema": generator.schema(reflect.TypeOf(route.Response))},
+			}
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): response,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorSchema},
+				},
+			},
+		}
+		path := apiPrefix + route.Path
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "LV Stock Tracker API",
+			"version": apiVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": generator.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "Workspace API key or admin key, also accepted in the X-API-Key header"},
+			},
+		},
+	}
+}
+
+// OpenAPI spec of apiRoutes, built on first request
+var (
+	openAPISpecOnce sync.Once
+	openAPISpec     []byte
+)
+
+func returnOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	openAPISpecOnce.Do(func() {
+		openAPISpec, _ = json.MarshalIndent(buildOpenAPISpec(apiRoutes), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"example.com/lvapi"
+	"net/http"
+)
+
+// Prefix of the current version of the API
+const apiPrefix = "/api/v1"
+
+// An apiParameter represents a path or query parameter of an API route.
+type apiParameter struct {
+	Name        string // Parameter name
+	In          string // Parameter location, path or query
+	Description string // Human readable description
+}
+
+// An apiRoute represents an API route, its handler, the types it exchanges and the role it requires.
+// Both the router and the OpenAPI spec are built from apiRoutes so they cannot drift apart.
+type apiRoute struct {
+	Method      string           // HTTP method
+	Path        string           // Path below the API prefix
+	Handler     http.HandlerFunc // Handler serving the route
+	Summary     string           // Human readable description
+	Parameters  []apiParameter   // Path and query parameters
+	Request     interface{}      // Value of the request body type, nil if there is none
+	Response    interface{}      // Value of the response body type, nil if there is none
+	Status      int              // Status of a successful response
+	ContentType string           // Content type of the response body
+	Role        string           // Role the API key of a request requires, empty for routes open to every request
+	Streamed    bool             // Whether the response is streamed or fanned out, so it may take longer than the write timeout
+}
+
+// Parameters shared by several routes
+var (
+	skuParameter       = apiParameter{Name: "sku", In: "path", Description: "Product identifier"}
+	regionParameter    = apiParameter{Name: "region", In: "query", Description: "Region code, the configured region if empty"}
+	formatParameter    = apiParameter{Name: "format", In: "query", Description: "csv to download the report as CSV, JSON if empty"}
+	imageHashParameter = apiParameter{Name: "hash", In: "path", Description: "SHA-256 of the image content"}
+	partParameter      = apiParameter{Name: "part", In: "query", Description: "watchlist, webhooks or history to only transfer that part, every part if empty, required for CSV"}
+)
+
+// Routes of the API, served below apiPrefix
+var apiRoutes = []apiRoute{
+	{
+		Method: http.MethodGet, Path: "/itemfamily/{sku}", Handler: returnItemFamily,
+		Summary:    "Availability of a product and its alternative styles",
+		Parameters: []apiParameter{skuParameter, regionParameter},
+		Response:   []lvapi.ProductAvailability{},
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}", Handler: returnItem,
+		Summary:    "Online availability and price of a product",
+		Parameters: []apiParameter{skuParameter},
+		Response:   lvapi.ProductAvailability{},
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}/prices", Handler: returnItemPrices,
+		Summary:    "Recorded price history of a product",
+		Parameters: []apiParameter{skuParameter, {Name: "region", In: "query", Description: "Region code, every region if empty"}},
+		Response:   []PriceRecord{},
+		Role:       RoleViewer,
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}/compare", Handler: returnItemPriceComparison,
+		Summary: "Price of a product in every region converted to one currency",
+		Parameters: []apiParameter{
+			skuParameter,
+			{Name: "currency", In: "query", Description: "Currency code to convert prices to, the exchange rate base if empty"},
+			{Name: "vat", In: "query", Description: "exclusive to compare prices without VAT, ranking prices whose VAT rate is unknown last"},
+		},
+		Response: []lvapi.RegionalPrice{},
+		Streamed: true,
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}/variants", Handler: returnItemVariants,
+		Summary:    "Size and color variants of a product",
+		Parameters: []apiParameter{skuParameter, regionParameter},
+		Response:   []lvapi.ProductVariant{},
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}/stores", Handler: returnItemStores,
+		Summary: "In-store availability of a product near a location or in a city",
+		Parameters: []apiParameter{
+			skuParameter, regionParameter,
+			{Name: "lat", In: "query", Description: "Latitude to search stores near, with lng"},
+			{Name: "lng", In: "query", Description: "Longitude to search stores near, with lat"},
+			{Name: "city", In: "query", Description: "City to search stores in, if lat and lng are not set"},
+		},
+		Response: []lvapi.StoreAvailability{},
+	},
+	{
+		Method: http.MethodGet, Path: "/item/{sku}/links", Handler: returnItemLinks,
+		Summary: "Canonical product page URL and the product page in the store of every region",
+		Parameters: []apiParameter{
+			skuParameter,
+			{Name: "region", In: "query", Description: "Region code to only link to the store of, every region if empty"},
+		},
+		Response: []lvapi.ProductPage{},
+	},
+	{
+		Method: http.MethodGet, Path: "/images/{sku}", Handler: returnItemImages,
+		Summary:    "Product images downloaded from the LV CDN, with the paths they and their thumbnails are served at",
+		Parameters: []apiParameter{skuParameter, {Name: "region", In: "query", Description: "Region code to look up images in if none are stored, the configured region if empty"}},
+		Response:   []ImageResult{},
+	},
+	{
+		Method: http.MethodGet, Path: "/images/{sku}/{hash}", Handler: returnImage,
+		Summary:     "Product image content",
+		Parameters:  []apiParameter{skuParameter, imageHashParameter},
+		ContentType: "image/*",
+	},
+	{
+		Method: http.MethodGet, Path: "/images/{sku}/{hash}/thumbnail", Handler: returnImageThumbnail,
+		Summary:     "JPEG thumbnail of a product image, the image itself if it has none",
+		Parameters:  []apiParameter{skuParameter, imageHashParameter},
+		ContentType: "image/jpeg",
+	},
+	{
+		Method: http.MethodPost, Path: "/items/availability", Handler: returnBulkAvailability,
+		Summary:     "Availability of many products in many regions, streamed as one JSON result per line",
+		Request:     BulkAvailabilityRequest{},
+		Response:    BulkAvailabilityResult{},
+		ContentType: "application/x-ndjson",
+		Streamed:    true,
+	},
+	{
+		Method: http.MethodGet, Path: "/family/{sku}", Handler: returnFamily,
+		Summary:    "Graph of the variants, colors and related products of a product",
+		Parameters: []apiParameter{skuParameter, regionParameter},
+		Response:   lvapi.ProductFamily{},
+	},
+	{
+		Method: http.MethodGet, Path: "/events/catalog", Handler: returnCatalogEvents,
+		Summary:    "Products added, removed or renamed in watched subcategories",
+		Parameters: []apiParameter{{Name: "since", In: "query", Description: "RFC 3339 time to return events after"}},
+		Response:   []Event{},
+	},
+	{
+		Method: http.MethodGet, Path: "/search", Handler: returnSearch,
+		Summary: "Products in watched subcategories matching a name or SKU, and checked products matching a SKU, allowing prefixes and typos",
+		Parameters: []apiParameter{
+			{Name: "q", In: "query", Description: "Product name or SKU to search for"},
+			{Name: "limit", In: "query", Description: "Maximum number of results, 20 if empty"},
+			{Name: "region", In: "query", Description: "Region code of the availability returned, the configured region if empty"},
+		},
+		Response: []SearchResult{},
+	},
+	{
+		// Registered before /analytics/{sku} so top-restocks is not taken for a sku
+		Method: http.MethodGet, Path: "/analytics/top-restocks", Handler: returnTopRestocks,
+		Summary: "Products that restocked most often, with their restock statistics",
+		Parameters: []apiParameter{
+			{Name: "region", In: "query", Description: "Region code to rank restocks in, every region if empty"},
+			{Name: "limit", In: "query", Description: "Maximum number of results, 20 if empty"},
+			formatParameter,
+		},
+		Response: []RestockAnalytics{},
+		Role:     RoleViewer,
+	},
+	{
+		Method: http.MethodGet, Path: "/analytics/{sku}", Handler: returnItemAnalytics,
+		Summary: "Restock statistics of a product in every region, from its recorded availability history",
+		Parameters: []apiParameter{
+			skuParameter,
+			{Name: "region", In: "query", Description: "Region code to only return statistics for, every region if empty"},
+			formatParameter,
+		},
+		Response: []RestockAnalytics{},
+		Role:     RoleViewer,
+	},
+	{
+		Method: http.MethodGet, Path: "/watchlist", Handler: returnWatchlist,
+		Summary:  "Entries polled for availability",
+		Response: []WatchEntry{},
+		Role:     RoleViewer,
+	},
+	{
+		Method: http.MethodPost, Path: "/watchlist", Handler: addWatchEntry,
+		Summary:  "Add an entry to the watchlist",
+		Request:  WatchEntry{},
+		Response: WatchEntry{},
+		Status:   http.StatusCreated,
+		Role:     RoleEditor,
+	},
+	{
+		Method: http.MethodDelete, Path: "/watchlist/{id}", Handler: removeWatchEntry,
+		Summary:    "Remove an entry from the watchlist",
+		Parameters: []apiParameter{{Name: "id", In: "path", Description: "Watchlist entry identifier"}},
+		Status:     http.StatusNoContent,
+		Role:       RoleEditor,
+	},
+	{
+		Method: http.MethodGet, Path: "/export", Handler: returnExport,
+		Summary:    "Watchlist, webhook subscriptions and availability history, to back up or import into another instance",
+		Parameters: []apiParameter{partParameter, {Name: "format", In: "query", Description: "csv to download the part as CSV, JSON if empty"}},
+		Response:   Export{},
+		Role:       RoleViewer,
+	},
+	{
+		Method: http.MethodPost, Path: "/import", Handler: importExport,
+		Summary: "Preview or apply the merge of an export of at most 32 MiB, as JSON or as CSV of one part, into the tracking setup",
+		Parameters: []apiParameter{
+			partParameter,
+			{Name: "format", In: "query", Description: "csv if the body is CSV, also implied by a text/csv Content-Type"},
+			{Name: "apply", In: "query", Description: "true to apply the import once it is valid, a dry run previewing it if empty"},
+		},
+		Request:  Export{},
+		Response: ImportReport{},
+		Role:     RoleEditor,
+	},
+	{
+		Method: http.MethodGet, Path: "/webhooks", Handler: returnWebhooks,
+		Summary:  "Webhooks notified of events about the products of the workspace",
+		Response: []WebhookSubscription{},
+		Role:     RoleViewer,
+	},
+	{
+		Method: http.MethodPost, Path: "/webhooks", Handler: addWebhook,
+		Summary:  "Subscribe a webhook to events about the products of the workspace",
+		Request:  WebhookSubscription{},
+		Response: WebhookSubscription{},
+		Status:   http.StatusCreated,
+		Role:     RoleEditor,
+	},
+	{
+		Method: http.MethodDelete, Path: "/webhooks", Handler: removeWebhook,
+		Summary:    "Unsubscribe a webhook subscribed at runtime",
+		Parameters: []apiParameter{{Name: "url", In: "query", Description: "URL of the webhook"}},
+		Status:     http.StatusNoContent,
+		Role:       RoleEditor,
+	},
+	{
+		Method: http.MethodGet, Path: "/workspace", Handler: returnWorkspace,
+		Summary:  "Workspace of the API key, the default workspace without key",
+		Response: WorkspaceInfo{},
+		Role:     RoleViewer,
+	},
+	{
+		Method: http.MethodDelete, Path: "/workspace", Handler: deleteOwnWorkspace,
+		Summary: "Delete the workspace of the API key with its watchlist, webhooks and keys",
+		Status:  http.StatusNoContent,
+		Role:    RoleOwner,
+	},
+	{
+		Method: http.MethodGet, Path: "/workspace/keys", Handler: returnAPIKeys,
+		Summary:  "API keys of the workspace",
+		Response: []APIKey{},
+		Role:     RoleOwner,
+	},
+	{
+		Method: http.MethodPost, Path: "/workspace/keys", Handler: addAPIKey,
+		Summary:  "Create an API key granting a role in the workspace, the key is only returned once",
+		Request:  APIKeyRequest{},
+		Response: NewAPIKey{},
+		Status:   http.StatusCreated,
+		Role:     RoleOwner,
+	},
+	{
+		Method: http.MethodDelete, Path: "/workspace/keys/{id}", Handler: removeAPIKey,
+		Summary:    "Revoke an API key of the workspace",
+		Parameters: []apiParameter{{Name: "id", In: "path", Description: "API key identifier"}},
+		Status:     http.StatusNoContent,
+		Role:       RoleOwner,
+	},
+	{
+		Method: http.MethodGet, Path: "/workspaces", Handler: returnWorkspaces,
+		Summary:  "Every workspace of the instance",
+		Response: []WorkspaceInfo{},
+		Role:     roleAdmin,
+	},
+	{
+		Method: http.MethodPost, Path: "/workspaces", Handler: createWorkspace,
+		Summary:  "Create a workspace and the owner key managing it",
+		Request:  WorkspaceRequest{},
+		Response: CreatedWorkspace{},
+		Status:   http.StatusCreated,
+		Role:     roleAdmin,
+	},
+	{
+		Method: http.MethodDelete, Path: "/workspaces/{workspace}", Handler: deleteWorkspace,
+		Summary:    "Delete a workspace with its watchlist, webhooks and keys",
+		Parameters: []apiParameter{{Name: "workspace", In: "path", Description: "Workspace identifier"}},
+		Status:     http.StatusNoContent,
+		Role:       roleAdmin,
+	},
+}
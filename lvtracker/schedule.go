@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"example.com/lvapi"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Days a week ahead a schedule looks for the next window opening
+const scheduleLookahead = 8
+
+// A PollWindow represents a daily time window in which a watchlist entry is polled at a higher
+// frequency, such as every 15 seconds between 09:55 and 10:30, when restocks usually drop.
+type PollWindow struct {
+	Start    string   `json:"Start"`          // Local time the window opens, such as 09:55
+	End      string   `json:"End"`            // Local time the window closes, before Start for windows spanning midnight
+	Interval string   `json:"Interval"`       // Interval between checks within the window, such as 15s
+	Days     []string `json:"Days,omitempty"` // Weekdays the window opens on, such as Mon, every day if empty
+}
+
+// A PollSchedule represents when a watchlist entry is polled: at the interval of the window
+// the local time falls in, and at a slow interval the rest of the day. Every interval is
+// raised to the configured minimum poll interval, and windows are polled on top of the
+// configured poll budget.
+type PollSchedule struct {
+	Windows  []PollWindow `json:"Windows"`            // High frequency windows
+	Interval string       `json:"Interval,omitempty"` // Interval between checks outside windows, set by the poll budget or poll interval if empty
+	TimeZone string       `json:"TimeZone,omitempty"` // IANA time zone of the windows, the time zone of the entry region if empty
+}
+
+// parseClock returns the minutes since midnight of clock, a time such as 09:55.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time such as 09:55", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekday returns the weekday named day, such as Mon or monday.
+func parseWeekday(day string) (time.Weekday, error) {
+	lower := strings.ToLower(strings.TrimSpace(day))
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		if lower == name || (len(lower) >= 3 && strings.HasPrefix(name, lower)) {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a weekday such as Mon", day)
+}
+
+// parseInterval returns the positive duration interval, such as 15s.
+func parseInterval(interval string) (time.Duration, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%q is not a positive duration such as 15s", interval)
+	}
+	return d, nil
+}
+
+// validate returns an error describing the first invalid setting of s. A nil schedule is valid.
+func (s *PollSchedule) validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Interval != "" {
+		if _, err := parseInterval(s.Interval); err != nil {
+			return fmt.Errorf("Schedule.Interval: %v", err)
+		}
+	}
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("Schedule.TimeZone: %q is not an IANA time zone", s.TimeZone)
+		}
+	}
+	if len(s.Windows) == 0 {
+		return errors.New("Schedule.Windows: at least one window is required")
+	}
+	for i, window := range s.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return fmt.Errorf("Schedule.Windows[%d].Start: %v", i, err)
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return fmt.Errorf("Schedule.Windows[%d].End: %v", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("Schedule.Windows[%d]: Start and End must differ", i)
+		}
+		if _, err := parseInterval(window.Interval); err != nil {
+			return fmt.Errorf("Schedule.Windows[%d].Interval: %v", i, err)
+		}
+		for _, day := range window.Days {
+			if _, err := parseWeekday(day); err != nil {
+				return fmt.Errorf("Schedule.Windows[%d].Days: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// opensOn returns whether w opens on weekday. The schedule must be valid.
+func (w PollWindow) opensOn(weekday time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if d, _ := parseWeekday(day); d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns whether the local time t falls in w. A window spanning midnight belongs to
+// the day it opens on. The schedule must be valid.
+func (w PollWindow) contains(t time.Time) bool {
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return start <= minute && minute < end && w.opensOn(t.Weekday())
+	}
+	if minute >= start {
+		return w.opensOn(t.Weekday())
+	}
+	return minute < end && w.opensOn(t.AddDate(0, 0, -1).Weekday())
+}
+
+// nextOpening returns the first time w opens after the local time t. The schedule must be valid.
+func (w PollWindow) nextOpening(t time.Time) (time.Time, bool) {
+	start, _ := parseClock(w.Start)
+	for day := 0; day < scheduleLookahead; day++ {
+		date := t.AddDate(0, 0, day)
+		opening := time.Date(date.Year(), date.Month(), date.Day(), start/60, start%60, 0, 0, t.Location())
+		if opening.After(t) && w.opensOn(opening.Weekday()) {
+			return opening, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// location returns the time zone the windows of s are in for an entry in region.
+func (s *PollSchedule) location(region string) *time.Location {
+	if s != nil && s.TimeZone != "" {
+		if location, err := time.LoadLocation(s.TimeZone); err == nil {
+			return location
+		}
+	}
+	return lvapi.RegionLocation(region)
+}
+
+// nextCheck returns when entry is due for its next check after a check at now: after the
+// interval of the window now falls in, or its slow interval, but no later than the opening of
+// its next window. interval is the slow interval of entries whose schedule sets none and of
+// entries without schedule. No interval is shorter than the configured minimum poll interval.
+func (entry WatchEntry) nextCheck(now time.Time, interval time.Duration) time.Time {
+	config := currentConfig()
+	schedule := entry.Schedule
+	if schedule != nil && schedule.Interval != "" {
+		interval, _ = parseInterval(schedule.Interval)
+	}
+	local := now.In(schedule.location(entry.Region))
+	var opening time.Time
+	if schedule != nil {
+		for _, window := range schedule.Windows {
+			if window.contains(local) {
+				if windowInterval, _ := parseInterval(window.Interval); windowInterval < interval {
+					interval = windowInterval
+				}
+			}
+			if next, found := window.nextOpening(local); found && (opening.IsZero() || next.Before(opening)) {
+				opening = next
+			}
+		}
+	}
+	if interval < config.MinPollInterval {
+		interval = config.MinPollInterval
+	}
+	next := now.Add(interval)
+	if !opening.IsZero() && opening.Before(next) {
+		next = opening
+	}
+	return next
+}
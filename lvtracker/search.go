@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"example.com/lvapi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Number of search results returned when the request sets no limit, and the most it may set
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Scores of a query term matching an indexed term exactly, as a prefix or within the edit distance
+const (
+	exactMatchScore  = 1.0
+	prefixMatchScore = 0.8
+	fuzzyMatchScore  = 0.6
+	skuMatchScore    = 2.0
+)
+
+// An indexedProduct represents a product found in a crawled subcategory.
+type indexedProduct struct {
+	sku       string
+	name      string
+	route     string
+	thumbnail string
+	terms     []string
+}
+
+// A SearchResult represents a product matching a search query.
+type SearchResult struct {
+	Sku       string  `json:"Sku"`                 // Product identifier
+	Name      string  `json:"Name"`                // Product name, empty if no watched subcategory listed it
+	Route     string  `json:"Route"`               // Product page route, empty if no watched subcategory listed it
+	Thumbnail string  `json:"Thumbnail,omitempty"` // Product image URL
+	Available *bool   `json:"Available"`           // Last recorded availability, null if never checked
+	Score     float64 `json:"Score"`               // Relevance to the query, higher is better
+}
+
+// A SearchIndex is an in-process full text index of the product names and SKUs found by the
+// catalog watcher, and of the SKUs of products checked by lvtracker, searched with prefix and
+// typo tolerant matching. Only the catalog watcher finds product names, so products of
+// subcategories that are not in catalog_subcategories can only be found by SKU.
+type SearchIndex struct {
+	mu            sync.RWMutex
+	products      map[string]*indexedProduct // Products keyed by sku
+	postings      map[string]map[string]bool // SKUs keyed by term
+	subcategories map[string][]string        // SKUs keyed by the subcategory URL they were found in
+	recorded      map[string]bool            // SKUs of products checked by lvtracker
+}
+
+// Index of products searched by /api/v1/search
+var searchIndex = NewSearchIndex()
+
+// NewSearchIndex creates an empty SearchIndex.
+// It returns the created SearchIndex.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		products:      make(map[string]*indexedProduct),
+		postings:      make(map[string]map[string]bool),
+		subcategories: make(map[string][]string),
+		recorded:      make(map[string]bool),
+	}
+}
+
+// searchTerms returns the lower case words of s, split on anything but letters and digits.
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// IndexSubcategory replaces the products indexed for subcategory with routes, using the images
+// of the same subcategory as thumbnails. Products no longer found in any subcategory are dropped.
+func (s *SearchIndex) IndexSubcategory(subcategory string, routes []lvapi.ProductRoute, images []lvapi.ProductImage) {
+	thumbnails := make(map[string]string)
+	for _, image := range images {
+		thumbnails[image.Name] = image.URL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var skus []string
+	for _, route := range routes {
+		sku := skuFromRoute(route.Route)
+		if sku == "" {
+			continue
+		}
+		s.add(&indexedProduct{sku: sku, name: route.Name, route: route.Route, thumbnail: thumbnails[route.Name]})
+		skus = append(skus, sku)
+	}
+	previous := s.subcategories[subcategory]
+	s.subcategories[subcategory] = skus
+	for _, sku := range previous {
+		if !s.listed(sku) && !s.recorded[sku] {
+			s.remove(sku)
+		}
+	}
+}
+
+// IndexSku indexes sku, a product checked by lvtracker, so it can be found by SKU even if no
+// watched subcategory lists it. A product indexed from a subcategory keeps its name, route and
+// thumbnail, and stays indexed once no subcategory lists it anymore.
+func (s *SearchIndex) IndexSku(sku string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorded[sku] = true
+	if _, found := s.products[sku]; !found {
+		s.add(&indexedProduct{sku: sku})
+	}
+}
+
+// add indexes product under the words of its name and its sku, replacing the product indexed
+// under the same sku. The caller must hold s.mu.
+func (s *SearchIndex) add(product *indexedProduct) {
+	s.remove(product.sku)
+	product.terms = append(searchTerms(product.name), strings.ToLower(product.sku))
+	for _, term := range product.terms {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[string]bool)
+		}
+		s.postings[term][product.sku] = true
+	}
+	s.products[product.sku] = product
+}
+
+// listed returns whether any subcategory lists sku. The caller must hold s.mu.
+func (s *SearchIndex) listed(sku string) bool {
+	for _, skus := range s.subcategories {
+		for _, listed := range skus {
+			if listed == sku {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remove drops sku from the index. The caller must hold s.mu.
+func (s *SearchIndex) remove(sku string) {
+	product, found := s.products[sku]
+	if !found {
+		return
+	}
+	for _, term := range product.terms {
+		delete(s.postings[term], sku)
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+	delete(s.products, sku)
+}
+
+// Search returns up to limit products matching query, best match first. Every word of the
+// query is matched against indexed words exactly, as a prefix, or with a typo or two, and an
+// exact SKU match ranks first.
+func (s *SearchIndex) Search(query string, limit int) []SearchResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scores := make(map[string]float64)
+	for _, queryTerm := range searchTerms(query) {
+		// Best score of this query term for every matching product
+		best := make(map[string]float64)
+		for term, skus := range s.postings {
+			score := matchScore(queryTerm, term)
+			if score == 0 {
+				continue
+			}
+			for sku := range skus {
+				if score > best[sku] {
+					best[sku] = score
+				}
+			}
+		}
+		for sku, score := range best {
+			scores[sku] += score
+		}
+		if product, found := s.products[strings.ToUpper(queryTerm)]; found {
+			scores[product.sku] += skuMatchScore
+		}
+	}
+	results := []SearchResult{}
+	for sku, score := range scores {
+		product := s.products[sku]
+		results = append(results, SearchResult{Sku: sku, Name: product.name, Route: product.route, Thumbnail: product.thumbnail, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matchScore returns how well queryTerm matches the indexed term, zero if it doesn't.
+// Terms of four letters or more may contain one typo, of eight or more two.
+func matchScore(queryTerm string, term string) float64 {
+	switch {
+	case queryTerm == term:
+		return exactMatchScore
+	case len(queryTerm) >= 2 && strings.HasPrefix(term, queryTerm):
+		return prefixMatchScore
+	}
+	maxDistance := 0
+	if len(queryTerm) >= 8 {
+		maxDistance = 2
+	} else if len(queryTerm) >= 4 {
+		maxDistance = 1
+	}
+	if maxDistance > 0 && editDistance(queryTerm, term, maxDistance) <= maxDistance {
+		return fuzzyMatchScore
+	}
+	return 0
+}
+
+// editDistance returns the Levenshtein distance between a and b, or max+1 as soon as it is
+// known to exceed max.
+func editDistance(a string, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// minInt returns the smallest of values.
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func returnSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "q is required", false)
+		return
+	}
+	limit := defaultSearchLimit
+	if l := query.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxSearchLimit {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit), false)
+			return
+		}
+	}
+	region := query.Get("region")
+	if region == "" {
+		region = currentConfig().Region
+	}
+	results := searchIndex.Search(q, limit)
+	for i := range results {
+		// Serve thumbnails stored locally rather than hot-linking the LV CDN
+		if thumbnail, found := imageStore.ThumbnailURL(results[i].Sku); found {
+			results[i].Thumbnail = thumbnail
+		}
+		if records := history.AvailabilityHistory(results[i].Sku, region); len(records) > 0 {
+			available := records[len(records)-1].Available
+			results[i].Available = &available
+		}
+	}
+	json.NewEncoder(w).Encode(results)
+}
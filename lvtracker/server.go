@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"example.com/lvapi"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Background jobs such as the pollers, cancelled and drained on shutdown
+var (
+	jobs              sync.WaitGroup
+	jobsCtx, stopJobs = context.WithCancel(context.Background())
+)
+
+// runJob runs job in the background. job must return soon after its context is done.
+func runJob(job func(ctx context.Context)) {
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		job(jobsCtx)
+	}()
+}
+
+// waitFor calls wait and waits for it to return until ctx is done.
+// It returns false if ctx was done first.
+func waitFor(ctx context.Context, wait func()) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// serve serves handler with the configured address and timeouts until SIGTERM or SIGINT is received.
+// It then stops accepting connections and reporting ready, and drains in-flight requests,
+// background jobs and webhook deliveries for up to the configured shutdown timeout.
+// It returns an error if the server failed or could not drain everything in time.
+func serve(handler http.Handler) error {
+	config := currentConfig()
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ConnContext:       withConn,
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	failed := make(chan error, 1)
+	go func() {
+		lvapi.Info(context.Background(), "listening", lvapi.F("addr", config.Listen))
+		failed <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-stop:
+		lvapi.Info(context.Background(), "shutting down", lvapi.F("signal", sig.String()), lvapi.F("timeout", config.ShutdownTimeout.String()))
+	}
+
+	readiness.SetShuttingDown()
+	// Persist history changes still batched, even if draining does not finish in time
+	defer history.Flush()
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	stopJobs()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if !waitFor(ctx, jobs.Wait) {
+		return errors.New("background jobs did not finish in time")
+	}
+	if !waitFor(ctx, notifier.Wait) {
+		return errors.New("webhook deliveries did not finish in time")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// Name of the tracer lvtracker server spans are created with
+const tracerName = "LVStockTracker/lvtracker"
+
+// Service name reported with every span unless OTEL_SERVICE_NAME is set
+const defaultServiceName = "lvtracker"
+
+// newTraceExporter creates an OTLP HTTP span exporter if an OTLP endpoint is configured through
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT. The exporter reads the
+// rest of its configuration, such as headers and TLS, from the standard OTEL_ variables.
+// It returns nil if no endpoint is configured, in which case tracing stays disabled.
+func newTraceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+	return otlptracehttp.New(ctx)
+}
+
+// setupTracing registers a global tracer provider batching spans to exporter, so spans started by
+// lvtracker and lvapi are exported. Any exporter can be passed, such as an in-memory one.
+// It returns a function flushing pending spans and stopping the provider.
+func setupTracing(exporter sdktrace.SpanExporter) func(context.Context) error {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = defaultServiceName
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown
+}
+
+// Flushes and stops the tracer provider, nothing to do while tracing is disabled
+var shutdownTracing = func(context.Context) error { return nil }
+
+// traceRoutes starts a server span for every request, named by route template rather than path
+// so SKUs don't create a span name each. The span continues a trace started by the client
+// if the request carries a traceparent header, and lvapi spans become its children.
+func traceRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+			))
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(recorder.status))
+		}
+	})
+}
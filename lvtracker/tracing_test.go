@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Product API response of a single available product
+const productJSON = `{"model":[{"identifier":"M40995","offers":{"price":"2100","priceCurrency":"CAD"},
+	"additionalProperty":[{"name":"backOrderDisclaimer","value":false}]}]}`
+
+// spanNamed returns the first span of spans named name, failing t if there is none.
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return tracetest.SpanStub{}
+}
+
+// assertChild fails t unless child is a child of parent in the same trace.
+func assertChild(t *testing.T, parent tracetest.SpanStub, child tracetest.SpanStub) {
+	t.Helper()
+	if child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("span %q is in trace %s, want %s", child.Name, child.SpanContext.TraceID(), parent.SpanContext.TraceID())
+	}
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("parent of span %q is %s, want %q %s", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+// newTestTracker sets up lvtracker against lv, a server standing in for the LV API and website.
+func newTestTracker(lv *httptest.Server) {
+	config := defaultConfig()
+	config.UpstreamAPI, config.UpstreamWebsite = lv.URL, lv.URL
+	config.RequestInterval = 0
+	applyConfig(config)
+	history = NewHistoryStore("")
+	notifier = NewNotifier(nil, "")
+	watchlist = NewWatchlist("")
+	workspaces = NewWorkspaceStore("")
+}
+
+func TestItemRequestSpans(t *testing.T) {
+	lv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/eng-ca/catalog/product/M40995" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(productJSON))
+	}))
+	defer lv.Close()
+	newTestTracker(lv)
+
+	exporter := tracetest.NewInMemoryExporter()
+	defer setupTracing(exporter)(context.Background())
+	router := mux.NewRouter()
+	router.Use(traceRoutes)
+	router.HandleFunc(apiPrefix+"/item/{sku}", returnItem)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, apiPrefix+"/item/M40995", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+	// Shutting down would reset the in-memory exporter, so only flush the batched spans to it
+	if err := otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	server := spanNamed(t, spans, "GET "+apiPrefix+"/item/{sku}")
+	fetch := spanNamed(t, spans, "lvapi.FetchLVProductAvailability")
+	request := spanNamed(t, spans, "HTTP GET")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("server span kind is %s, want server", server.SpanKind)
+	}
+	if server.Parent.IsValid() {
+		t.Errorf("server span has parent %s, want a new trace", server.Parent.SpanID())
+	}
+	assertChild(t, server, fetch)
+	assertChild(t, fetch, request)
+	if request.SpanKind != trace.SpanKindClient {
+		t.Errorf("outbound span kind is %s, want client", request.SpanKind)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"example.com/lvapi"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of the export format, raised when it changes incompatibly
+const exportVersion = 1
+
+// Largest import body read, in bytes, about 300000 availability records. Imports are read
+// into memory whole, dry runs included.
+const maxImportSize = 32 << 20
+
+// Parts of the tracking setup exported and imported separately, such as with CSV
+const (
+	partWatchlist = "watchlist"
+	partWebhooks  = "webhooks"
+	partHistory   = "history"
+)
+
+// Columns of the CSV export of every part
+var exportColumns = map[string][]string{
+	partWatchlist: {"ID", "Sku", "Region", "Size", "Schedule"},
+	partWebhooks:  {"URL"},
+	partHistory:   {"Sku", "Region", "Available", "Time"},
+}
+
+// Columns a CSV import of every part requires, the others are optional
+var requiredColumns = map[string][]string{
+	partWatchlist: {"Sku"},
+	partWebhooks:  {"URL"},
+	partHistory:   {"Sku", "Region", "Available", "Time"},
+}
+
+// An Export represents the tracking setup of lvtracker: its watchlist, webhook subscriptions and
+// availability history, to back it up or share it with another instance.
+type Export struct {
+	Version      int                  `json:"Version"`                // Export format version
+	Exported     time.Time            `json:"Exported"`               // Time the export was made
+	Watchlist    []WatchEntry         `json:"Watchlist,omitempty"`    // Watchlist entries, their IDs are not imported
+	Webhooks     []string             `json:"Webhooks,omitempty"`     // Webhook URLs notified of events
+	Availability []AvailabilityRecord `json:"Availability,omitempty"` // Availability history, oldest first for each sku
+}
+
+// ImportCounts represents what an import did, or would do, to a part of the tracking setup.
+type ImportCounts struct {
+	Added     int `json:"Added"`     // Records added
+	Merged    int `json:"Merged"`    // Records merged into a conflicting record already present
+	Unchanged int `json:"Unchanged"` // Records already present, left out
+	Skipped   int `json:"Skipped"`   // Records the workspace may not import, left out
+}
+
+// An ImportError represents an invalid record of an import.
+type ImportError struct {
+	Part    string `json:"Part"`    // Part the record belongs to: watchlist, webhooks or history
+	Record  int    `json:"Record"`  // Position of the record in its part, starting at 1
+	Message string `json:"Message"` // Reason the record is invalid
+}
+
+// An ImportReport represents the outcome of an import. A dry run reports what the import would do
+// without changing anything, and an import is only applied if none of its records is invalid.
+type ImportReport struct {
+	DryRun    bool          `json:"DryRun"`    // Whether nothing was changed
+	Watchlist ImportCounts  `json:"Watchlist"` // Outcome for watchlist entries
+	Webhooks  ImportCounts  `json:"Webhooks"`  // Outcome for webhook subscriptions
+	History   ImportCounts  `json:"History"`   // Outcome for availability records
+	Errors    []ImportError `json:"Errors"`    // Invalid records
+}
+
+// requestedPart returns the part query parameter of r, empty for every part.
+func requestedPart(r *http.Request) (string, error) {
+	part := strings.ToLower(r.URL.Query().Get("part"))
+	if _, found := exportColumns[part]; part != "" && !found {
+		return "", fmt.Errorf("part must be %s, %s or %s", partWatchlist, partWebhooks, partHistory)
+	}
+	return part, nil
+}
+
+// exportTracking returns the tracking setup of the workspace p acts in, with the history it
+// views, only part of it if part is not empty.
+func exportTracking(p principal, part string) Export {
+	export := Export{Version: exportVersion, Exported: time.Now()}
+	if part == "" || part == partWatchlist {
+		export.Watchlist = p.watchlist().List()
+	}
+	if part == "" || part == partWebhooks {
+		export.Webhooks = p.subscriptions().Webhooks()
+	}
+	if part == "" || part == partHistory {
+		for _, sku := range history.AvailabilitySkus() {
+			for _, record := range history.AvailabilityHistory(sku, "") {
+				if p.views(record.Sku, record.Region) {
+					export.Availability = append(export.Availability, record)
+				}
+			}
+		}
+	}
+	return export
+}
+
+// only returns e with every part but part left out.
+func (e Export) only(part string) Export {
+	filtered := Export{Version: e.Version, Exported: e.Exported}
+	switch part {
+	case partWatchlist:
+		filtered.Watchlist = e.Watchlist
+	case partWebhooks:
+		filtered.Webhooks = e.Webhooks
+	case partHistory:
+		filtered.Availability = e.Availability
+	}
+	return filtered
+}
+
+// csvRows returns the CSV rows of part of export, without headers.
+func (e Export) csvRows(part string) [][]string {
+	var rows [][]string
+	switch part {
+	case partWatchlist:
+		for _, entry := range e.Watchlist {
+			schedule := ""
+			if entry.Schedule != nil {
+				data, _ := json.Marshal(entry.Schedule)
+				schedule = string(data)
+			}
+			rows = append(rows, []string{strconv.Itoa(entry.ID), entry.Sku, entry.Region, entry.Size, schedule})
+		}
+	case partWebhooks:
+		for _, webhook := range e.Webhooks {
+			rows = append(rows, []string{webhook})
+		}
+	case partHistory:
+		for _, record := range e.Availability {
+			rows = append(rows, []string{record.Sku, record.Region, strconv.FormatBool(record.Available), record.Time.Format(time.RFC3339Nano)})
+		}
+	}
+	return rows
+}
+
+// readExportCSV reads part of an export from CSV with a header row naming the columns, in any
+// order and case. Columns other than those of the part are ignored, and so are IDs, which are
+// assigned on import.
+// It returns the export, or an error if the CSV is malformed or a value cannot be parsed.
+func readExportCSV(body io.Reader, part string) (Export, error) {
+	export := Export{Version: exportVersion}
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return export, err
+	}
+	if len(rows) == 0 {
+		return export, errors.New("CSV has no header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredColumns[part] {
+		if _, found := columns[strings.ToLower(name)]; !found {
+			return export, fmt.Errorf("CSV has no %s column", name)
+		}
+	}
+	value := func(row []string, name string) string {
+		if i, found := columns[strings.ToLower(name)]; found && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	for line, row := range rows[1:] {
+		switch part {
+		case partWatchlist:
+			entry := WatchEntry{Sku: value(row, "Sku"), Region: value(row, "Region"), Size: value(row, "Size")}
+			if schedule := value(row, "Schedule"); schedule != "" {
+				if err := json.Unmarshal([]byte(schedule), &entry.Schedule); err != nil {
+					return export, fmt.Errorf("line %d: Schedule is not a JSON schedule", line+2)
+				}
+			}
+			export.Watchlist = append(export.Watchlist, entry)
+		case partWebhooks:
+			export.Webhooks = append(export.Webhooks, value(row, "URL"))
+		case partHistory:
+			available, err := strconv.ParseBool(value(row, "Available"))
+			if err != nil {
+				return export, fmt.Errorf("line %d: Available is neither true nor false", line+2)
+			}
+			t, err := time.Parse(time.RFC3339Nano, value(row, "Time"))
+			if err != nil {
+				return export, fmt.Errorf("line %d: Time is not an RFC 3339 time", line+2)
+			}
+			export.Availability = append(export.Availability, AvailabilityRecord{Sku: value(row, "Sku"), Region: value(row, "Region"), Available: available, Time: t})
+		}
+	}
+	return export, nil
+}
+
+// watchEntryError returns why entry cannot be imported, or nil if it can.
+func watchEntryError(entry WatchEntry) error {
+	if err := lvapi.ValidateSKU(entry.Sku); err != nil {
+		return fmt.Errorf("Malformed SKU: %q", entry.Sku)
+	}
+	if entry.Region != "" && !regionCodePattern.MatchString(entry.Region) {
+		return fmt.Errorf("%q is not a region code such as eng-ca", entry.Region)
+	}
+	return entry.Schedule.validate()
+}
+
+// availabilityRecordError returns why record cannot be imported, or nil if it can.
+func availabilityRecordError(record AvailabilityRecord) error {
+	if err := lvapi.ValidateSKU(record.Sku); err != nil {
+		return fmt.Errorf("Malformed SKU: %q", record.Sku)
+	}
+	if !regionCodePattern.MatchString(record.Region) {
+		return fmt.Errorf("%q is not a region code such as eng-ca", record.Region)
+	}
+	if record.Time.IsZero() || record.Time.After(time.Now()) {
+		return errors.New("Time must be set and not in the future")
+	}
+	return nil
+}
+
+// validate returns the valid records of e and the reason every other record is invalid.
+func (e Export) validate(ctx context.Context) (Export, []ImportError) {
+	valid := Export{Version: e.Version, Exported: e.Exported}
+	invalid := []ImportError{}
+	for i, entry := range e.Watchlist {
+		if err := watchEntryError(entry); err != nil {
+			invalid = append(invalid, ImportError{Part: partWatchlist, Record: i + 1, Message: err.Error()})
+			continue
+		}
+		valid.Watchlist = append(valid.Watchlist, entry)
+	}
+	for i, webhook := range e.Webhooks {
+		if err := checkWebhookURL(ctx, webhook); err != nil {
+			invalid = append(invalid, ImportError{Part: partWebhooks, Record: i + 1, Message: err.Error()})
+			continue
+		}
+		valid.Webhooks = append(valid.Webhooks, webhook)
+	}
+	for i, record := range e.Availability {
+		if err := availabilityRecordError(record); err != nil {
+			invalid = append(invalid, ImportError{Part: partHistory, Record: i + 1, Message: err.Error()})
+			continue
+		}
+		valid.Availability = append(valid.Availability, record)
+	}
+	return valid, invalid
+}
+
+// importTracking merges e into the tracking setup of the workspace p acts in, or only reports
+// what it would change if dryRun is set. Nothing is changed if any record of e is invalid, and
+// the counts of the report only cover valid records. The history is shared by every workspace,
+// so only the default workspace imports it, and other workspaces count its records as skipped.
+// It returns the report of the import.
+func importTracking(ctx context.Context, p principal, e Export, dryRun bool) ImportReport {
+	valid, invalid := e.validate(ctx)
+	report := ImportReport{DryRun: dryRun || len(invalid) > 0, Errors: invalid}
+	report.Watchlist.Added, report.Watchlist.Merged, report.Watchlist.Unchanged = p.watchlist().Merge(valid.Watchlist, report.DryRun)
+	report.Webhooks.Added, report.Webhooks.Unchanged = p.subscriptions().Subscribe(valid.Webhooks, report.DryRun)
+	if p.workspace != nil {
+		report.History.Skipped = len(valid.Availability)
+		return report
+	}
+	report.History.Added, report.History.Unchanged = history.MergeAvailability(valid.Availability, report.DryRun)
+	return report
+}
+
+func returnExport(w http.ResponseWriter, r *http.Request) {
+	part, err := requestedPart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error(), false)
+		return
+	}
+	if !wantsCSV(r) {
+		json.NewEncoder(w).Encode(exportTracking(requestPrincipal(r), part))
+		return
+	}
+	if part == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "CSV exports require a part", false)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="lvtracker-`+part+`.csv"`)
+	out := csv.NewWriter(w)
+	out.Write(exportColumns[part])
+	out.WriteAll(exportTracking(requestPrincipal(r), part).csvRows(part))
+}
+
+func importExport(w http.ResponseWriter, r *http.Request) {
+	part, err := requestedPart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error(), false)
+		return
+	}
+	// A body cut off at the limit was longer than it
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if len(body) == maxImportSize && err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeInvalidRequest, fmt.Sprintf("Import is limited to %d bytes", maxImportSize), false)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Unable to read import", false)
+		return
+	}
+	var export Export
+	if r.URL.Query().Get("format") == "csv" || strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		if part == "" {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "CSV imports require a part", false)
+			return
+		}
+		if export, err = readExportCSV(bytes.NewReader(body), part); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid CSV: "+err.Error(), false)
+			return
+		}
+	} else if err := json.Unmarshal(body, &export); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Import requires a JSON export", false)
+		return
+	}
+	if export.Version > exportVersion {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Export version %d is newer than the supported version %d", export.Version, exportVersion), false)
+		return
+	}
+	// Only import the requested part of a complete export
+	if part != "" {
+		export = export.only(part)
+	}
+	apply, _ := strconv.ParseBool(r.URL.Query().Get("apply"))
+	report := importTracking(r.Context(), requestPrincipal(r), export, !apply)
+	if apply && len(report.Errors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/lvapi"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A WatchEntry represents a product sku polled for availability in a region.
+// If Size is set only the variant of that size is checked.
+type WatchEntry struct {
+	ID       int           `json:"ID"`                 // Entry identifier
+	Sku      string        `json:"Sku"`                // Product identifier
+	Region   string        `json:"Region"`             // Region code to check availability in
+	Size     string        `json:"Size"`               // Variant size to check, empty for the product itself
+	Schedule *PollSchedule `json:"Schedule,omitempty"` // High frequency polling windows, polled every configured poll interval if nil
+}
+
+// key returns what identifies the product entry checks: entries with the same key, such as in
+// the watchlists of several workspaces, are checked once for all of them.
+func (entry WatchEntry) key() string {
+	return entry.Sku + "/" + entry.Region + "/" + strings.ToLower(strings.TrimSpace(entry.Size))
+}
+
+// SKUs of the variants checked for entries with a size, keyed by entry key
+var variantSkus = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// recordedSku returns the SKU checks of entry record history and send notifications under:
+// the SKU of the variant of its size, or the entry SKU without size. It returns an empty
+// string while no check found the variant yet.
+func (entry WatchEntry) recordedSku() string {
+	if entry.Size == "" {
+		return entry.Sku
+	}
+	variantSkus.RLock()
+	defer variantSkus.RUnlock()
+	return variantSkus.m[entry.key()]
+}
+
+// records returns whether checks of entry record sku in region, in any region if region is empty.
+func (entry WatchEntry) records(sku string, region string) bool {
+	return sku != "" && entry.recordedSku() == sku && (region == "" || entry.Region == region)
+}
+
+// Signaled when an entry of any watchlist is added or removed, a pending value covers every change since
+var watchlistChanges = make(chan struct{}, 1)
+
+// A Watchlist holds the entries polled by the watchlist poller.
+// If path is set, the watchlist is persisted as JSON after every change.
+type Watchlist struct {
+	mu      sync.Mutex
+	path    string
+	changed chan struct{} // Signaled when an entry is added or removed, shared by every watchlist
+	NextID  int           `json:"NextID"`  // Identifier of the next added entry
+	Entries []WatchEntry  `json:"Entries"` // Watched entries
+}
+
+// NewWatchlist creates a Watchlist persisted at path.
+// Any entries already saved at path are loaded. An empty path keeps the watchlist in memory only.
+// It returns the created Watchlist.
+func NewWatchlist(path string) *Watchlist {
+	w := &Watchlist{path: path, changed: watchlistChanges, NextID: 1}
+	if path == "" {
+		return w
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lvapi.Error(context.Background(), "unable to read watchlist", lvapi.F("path", path), lvapi.F("error", err))
+		}
+		return w
+	}
+	if err := json.Unmarshal(data, w); err != nil {
+		lvapi.Error(context.Background(), "unable to parse watchlist", lvapi.F("path", path), lvapi.F("error", err))
+	}
+	return w
+}
+
+// Add adds entry to the watchlist, defaulting its region to the configured region.
+// It returns the added entry with its assigned ID.
+func (w *Watchlist) Add(entry WatchEntry) WatchEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entry.ID = w.NextID
+	w.NextID++
+	if entry.Region == "" {
+		entry.Region = currentConfig().Region
+	}
+	w.Entries = append(w.Entries, entry)
+	w.save()
+	w.signal()
+	return entry
+}
+
+// Remove removes the entry with id from the watchlist.
+// It returns false if there is no such entry.
+func (w *Watchlist) Remove(id int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, entry := range w.Entries {
+		if entry.ID == id {
+			w.Entries = append(w.Entries[:i], w.Entries[i+1:]...)
+			w.save()
+			w.signal()
+			return true
+		}
+	}
+	return false
+}
+
+// Merge adds every entry of entries not watched yet, with the same sku, region and size, and
+// replaces the schedule of watched entries with the schedule of their imported entry, if it has
+// one. Regions default to the configured region. With dryRun set the watchlist is not changed.
+// It returns the number of entries added, merged into watched entries and already watched as is,
+// or that would be.
+func (w *Watchlist) Merge(entries []WatchEntry, dryRun bool) (added int, merged int, unchanged int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watched := make(map[string]int)
+	for i, entry := range w.Entries {
+		watched[entry.key()] = i
+	}
+	// Changes are made to a copy so a dry run leaves the watchlist as is
+	result := append([]WatchEntry{}, w.Entries...)
+	nextID := w.NextID
+	for _, entry := range entries {
+		if entry.Region == "" {
+			entry.Region = currentConfig().Region
+		}
+		i, found := watched[entry.key()]
+		switch {
+		case !found:
+			entry.ID = nextID
+			nextID++
+			watched[entry.key()] = len(result)
+			result = append(result, entry)
+			added++
+		case entry.Schedule != nil && !reflect.DeepEqual(entry.Schedule, result[i].Schedule):
+			result[i].Schedule = entry.Schedule
+			merged++
+		default:
+			unchanged++
+		}
+	}
+	if dryRun || added+merged == 0 {
+		return added, merged, unchanged
+	}
+	w.Entries, w.NextID = result, nextID
+	w.save()
+	w.signal()
+	return added, merged, unchanged
+}
+
+// List returns a copy of the watchlist entries.
+func (w *Watchlist) List() []WatchEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]WatchEntry{}, w.Entries...)
+}
+
+// Watches returns whether the checks of an entry record sku in region, in any region if region
+// is empty. Entries with a size watch the SKU of their variant rather than the entry SKU.
+func (w *Watchlist) Watches(sku string, region string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, entry := range w.Entries {
+		if entry.records(sku, region) {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns a channel receiving a value after entries of any watchlist are added or removed.
+func (w *Watchlist) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// signal notifies Changed without blocking, a pending notification covers every change since.
+func (w *Watchlist) signal() {
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the watchlist to its path as JSON. The caller must hold w.mu.
+func (w *Watchlist) save() {
+	if w.path == "" {
+		return
+	}
+	data, err := json.Marshal(w)
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to encode watchlist", lvapi.F("error", err))
+		return
+	}
+	if err := writeFileAtomic(w.path, data, 0644); err != nil {
+		lvapi.Error(context.Background(), "unable to write watchlist", lvapi.F("path", w.path), lvapi.F("error", err))
+	}
+}
+
+// checkWatchEntry fetches the availability of entry and records it into the history store.
+// Entries targeting a size are checked against the variant of that size.
+func checkWatchEntry(ctx context.Context, entry WatchEntry) {
+	// A failed check records nothing, recording the product as unavailable would report a restock
+	// once the LV API answers again
+	if entry.Size == "" {
+		product, err := lvapi.FetchLVProductAvailability(ctx, entry.Sku, entry.Region)
+		if err != nil {
+			lvapi.Warn(ctx, "watchlist check failed", lvapi.F("sku", entry.Sku), lvapi.F("region", entry.Region), lvapi.F("error", err))
+			return
+		}
+		recordProduct(ctx, product, entry.Region)
+		return
+	}
+	variants, err := lvapi.FetchLVProductVariants(ctx, entry.Sku, entry.Region)
+	if err != nil {
+		lvapi.Warn(ctx, "watchlist check failed", lvapi.F("sku", entry.Sku), lvapi.F("region", entry.Region), lvapi.F("error", err))
+		return
+	}
+	for _, variant := range variants {
+		if strings.EqualFold(variant.Size, strings.TrimSpace(entry.Size)) {
+			variantSkus.Lock()
+			variantSkus.m[entry.key()] = variant.Sku
+			variantSkus.Unlock()
+			recordProduct(ctx, lvapi.ProductAvailability{Sku: variant.Sku, Available: variant.Available, Price: variant.Price, Currency: variant.Currency}, entry.Region)
+			return
+		}
+	}
+	lvapi.Warn(ctx, "no variant of size found", lvapi.F("sku", entry.Sku), lvapi.F("region", entry.Region), lvapi.F("size", entry.Size))
+}
+
+// allWatchEntries returns the entries of the watchlist and of the watchlist of every workspace.
+func allWatchEntries() []WatchEntry {
+	entries := watchlist.List()
+	for _, w := range workspaces.Watchlists() {
+		entries = append(entries, w.List()...)
+	}
+	return entries
+}
+
+// nextTargetCheck returns when the product watched by entries, entries with the same key, is
+// due for its next check after a check at now: when the first of entries is due.
+func nextTargetCheck(entries []WatchEntry, now time.Time, interval time.Duration) time.Time {
+	var next time.Time
+	for _, entry := range entries {
+		if due := entry.nextCheck(now, interval); next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// pollWatchlist checks every entry of the watchlist and of the watchlists of every workspace when
+// it is due until ctx is done, following the schedule of the entry and otherwise its share of the
+// poll budget, or the configured poll interval without budget. Entries watching the same product
+// in the same region are checked once, when the first of them is due, so workspaces sharing SKUs
+// don't multiply upstream requests. New entries are checked right away. A check in progress when
+// ctx is done is finished, the remaining entries are skipped.
+// Each round of checks is logged under its own request ID.
+func pollWatchlist(ctx context.Context) {
+	// Time every product was last checked, keyed by entry key
+	checked := make(map[string]time.Time)
+	for {
+		cycle := lvapi.WithRequestID(ctx, lvapi.NewRequestID())
+		targets := make(map[string][]WatchEntry)
+		var products []WatchEntry
+		for _, entry := range allWatchEntries() {
+			if _, found := targets[entry.key()]; !found {
+				products = append(products, entry)
+			}
+			targets[entry.key()] = append(targets[entry.key()], entry)
+		}
+		// Due times follow the current budget, so entries speed up as their likely restock hours come
+		intervals := budgetIntervals(products, time.Now())
+		wake := time.Now().Add(currentConfig().PollInterval)
+		round := false
+		for _, product := range products {
+			if ctx.Err() != nil {
+				return
+			}
+			key := product.key()
+			last, found := checked[key]
+			next := nextTargetCheck(targets[key], last, intervals[key])
+			if !found || !time.Now().Before(next) {
+				checkWatchEntry(cycle, product)
+				availabilityChecks.Inc()
+				round = true
+				last = time.Now()
+				checked[key] = last
+				next = nextTargetCheck(targets[key], last, intervals[key])
+			}
+			if next.Before(wake) {
+				wake = next
+			}
+		}
+		for key := range checked {
+			if _, found := targets[key]; !found {
+				delete(checked, key)
+			}
+		}
+		if round {
+			pollCycles.WithLabelValues("watchlist").Inc()
+		}
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-watchlist.Changed():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"github.com/andybalholm/brotli"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Build the React client into web/dist so it is embedded into the binary.
+//go:generate sh -c "cd ../client/lv-stock-tracker && npm ci && npm run build && rm -rf ../../lvtracker/web/dist && cp -r build ../../lvtracker/web/dist"
+
+// Production build of client/lv-stock-tracker in web/dist, or a placeholder page in web if the
+// client was not built before compiling
+//
+//go:embed web
+var webFiles embed.FS
+
+// A staticAsset represents an embedded file and its compressed encodings, compressed on first use.
+type staticAsset struct {
+	name     string
+	content  []byte
+	etag     string
+	once     sync.Once
+	gzipped  []byte
+	brotlied []byte
+}
+
+// compress fills in the gzip and brotli encodings of a, leaving those that aren't smaller empty.
+func (a *staticAsset) compress() {
+	var buf bytes.Buffer
+	gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	gz.Write(a.content)
+	gz.Close()
+	if buf.Len() < len(a.content) {
+		a.gzipped = append([]byte(nil), buf.Bytes()...)
+	}
+	buf.Reset()
+	br := brotli.NewWriterLevel(&buf, 9)
+	br.Write(a.content)
+	br.Close()
+	if buf.Len() < len(a.content) {
+		a.brotlied = append([]byte(nil), buf.Bytes()...)
+	}
+}
+
+// isCompressible returns whether files of the content type are worth compressing.
+func isCompressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml")
+}
+
+// A staticHandler serves the embedded client, falling back to index.html for paths that aren't
+// files so client side routes can be opened directly.
+type staticHandler struct {
+	assets map[string]*staticAsset
+}
+
+// newStaticHandler creates a staticHandler serving the files of root.
+// It returns the created staticHandler.
+func newStaticHandler(root fs.FS) (*staticHandler, error) {
+	h := &staticHandler{assets: make(map[string]*staticAsset)}
+	err := fs.WalkDir(root, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(root, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		h.assets["/"+name] = &staticAsset{name: name, content: content, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	return h, err
+}
+
+// webRoot returns the client build embedded in web/dist, or the placeholder in web without one.
+func webRoot() fs.FS {
+	if dist, err := fs.Sub(webFiles, "web/dist"); err == nil {
+		if _, err := fs.Stat(dist, "index.html"); err == nil {
+			return dist
+		}
+	}
+	root, _ := fs.Sub(webFiles, "web")
+	return root
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	if name == "/" {
+		name = "/index.html"
+	}
+	asset, found := h.assets[name]
+	if !found {
+		// Unknown API paths and missing files are not client side routes
+		if strings.HasPrefix(name, "/api/") || path.Ext(name) != "" {
+			returnNotFound(w, r)
+			return
+		}
+		asset = h.assets["/index.html"]
+		if asset == nil {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	// Files under static/ have content hashed names and never change
+	if strings.HasPrefix(asset.name, "static/") {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	contentType := mime.TypeByExtension(path.Ext(asset.name))
+	if contentType == "" {
+		contentType = http.DetectContentType(asset.content)
+	}
+	w.Header().Set("Content-Type", contentType)
+	content, etag := asset.content, asset.etag
+	if isCompressible(contentType) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		asset.once.Do(asset.compress)
+		accepted := r.Header.Get("Accept-Encoding")
+		if strings.Contains(accepted, "br") && asset.brotlied != nil {
+			w.Header().Set("Content-Encoding", "br")
+			content, etag = asset.brotlied, strings.TrimSuffix(etag, `"`)+`-br"`
+		} else if strings.Contains(accepted, "gzip") && asset.gzipped != nil {
+			w.Header().Set("Content-Encoding", "gzip")
+			content, etag = asset.gzipped, strings.TrimSuffix(etag, `"`)+`-gzip"`
+		}
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, asset.name, time.Time{}, bytes.NewReader(content))
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"example.com/lvapi"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles an API key grants in its workspace. Owners manage the workspace and its keys, editors
+// change its watchlist and webhooks, and viewers read them and the history of watched SKUs.
+// Every role is allowed everything the roles below it are.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Role of routes only the administrator of the instance may call, such as creating workspaces
+const roleAdmin = "admin"
+
+// Rank of every role, a role is allowed what roles of lower rank are
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// Identifier of the default workspace, the watchlist and webhooks predating workspaces
+const defaultWorkspaceID = "default"
+
+// Prefix of the API keys of workspaces, so leaked keys are easy to recognise
+const apiKeyPrefix = "lvt_"
+
+// An APIKey represents a key granting a role in a workspace. Only the hash of the key is stored.
+type APIKey struct {
+	ID      string    `json:"ID"`             // Key identifier
+	Name    string    `json:"Name"`           // Human readable name, such as the team member or service using it
+	Role    string    `json:"Role"`           // Role the key grants: owner, editor or viewer
+	Created time.Time `json:"Created"`        // Time the key was created
+	Hash    string    `json:"Hash,omitempty"` // SHA-256 of the key, only persisted
+}
+
+// A NewAPIKey represents an API key just created, the only time the key itself is returned.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"Key"` // Key to send as a Bearer token or in the X-API-Key header
+}
+
+// An APIKeyRequest represents the API key to create in a workspace.
+type APIKeyRequest struct {
+	Name string `json:"Name"` // Human readable name
+	Role string `json:"Role"` // Role the key grants: owner, editor or viewer
+}
+
+// A Workspace represents a team sharing the instance, with its own watchlist, webhooks and API
+// keys. The history is shared by every workspace, each viewing the history of the SKUs it watches.
+type Workspace struct {
+	ID            string    `json:"ID"`      // Workspace identifier
+	Name          string    `json:"Name"`    // Human readable name
+	Created       time.Time `json:"Created"` // Time the workspace was created
+	Keys          []APIKey  `json:"Keys"`    // API keys of the workspace
+	watchlist     *Watchlist
+	subscriptions *Notifier // Holds the webhooks of the workspace, events are delivered by notifier
+}
+
+// A WorkspaceInfo represents a workspace as returned by the API.
+type WorkspaceInfo struct {
+	ID       string    `json:"ID"`             // Workspace identifier
+	Name     string    `json:"Name"`           // Human readable name
+	Created  time.Time `json:"Created"`        // Time the workspace was created, zero for the default workspace
+	Role     string    `json:"Role,omitempty"` // Role of the API key of the request, if it belongs to the workspace
+	Entries  int       `json:"Entries"`        // Number of watchlist entries
+	Webhooks int       `json:"Webhooks"`       // Number of webhooks notified of events
+}
+
+// A WorkspaceRequest represents the workspace to create.
+type WorkspaceRequest struct {
+	Name string `json:"Name"` // Human readable name
+}
+
+// A CreatedWorkspace represents a workspace just created with the owner key to manage it.
+type CreatedWorkspace struct {
+	Workspace WorkspaceInfo `json:"Workspace"` // Created workspace
+	Key       NewAPIKey     `json:"Key"`       // API key owning the workspace
+}
+
+// A WorkspaceStore holds the workspaces of the instance. If dir is set, the workspaces and their
+// keys are persisted as JSON to index.json in dir after every change, and the watchlist and
+// webhooks of every workspace to a directory in dir named after it.
+type WorkspaceStore struct {
+	mu         sync.RWMutex
+	dir        string
+	Workspaces map[string]*Workspace `json:"Workspaces"` // Workspaces keyed by ID
+}
+
+// Workspaces sharing the instance
+var workspaces *WorkspaceStore
+
+// NewWorkspaceStore creates a WorkspaceStore persisted in dir.
+// Any workspaces already saved in dir are loaded. An empty dir keeps the workspaces in memory only.
+// It returns the created WorkspaceStore.
+func NewWorkspaceStore(dir string) *WorkspaceStore {
+	s := &WorkspaceStore{dir: dir, Workspaces: make(map[string]*Workspace)}
+	if dir == "" {
+		return s
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		lvapi.Error(context.Background(), "unable to create workspace directory", lvapi.F("path", dir), lvapi.F("error", err))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			lvapi.Error(context.Background(), "unable to read workspaces", lvapi.F("path", dir), lvapi.F("error", err))
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		lvapi.Error(context.Background(), "unable to parse workspaces", lvapi.F("path", dir), lvapi.F("error", err))
+	}
+	if s.Workspaces == nil {
+		s.Workspaces = make(map[string]*Workspace)
+	}
+	for _, workspace := range s.Workspaces {
+		s.open(workspace)
+	}
+	return s
+}
+
+// open loads the watchlist and webhooks of workspace.
+func (s *WorkspaceStore) open(workspace *Workspace) {
+	watchlistPath, subscriptionsPath := "", ""
+	if s.dir != "" {
+		dir := filepath.Join(s.dir, workspace.ID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			lvapi.Error(context.Background(), "unable to create workspace directory", lvapi.F("path", dir), lvapi.F("error", err))
+		}
+		watchlistPath, subscriptionsPath = filepath.Join(dir, "watchlist.json"), filepath.Join(dir, "subscriptions.json")
+	}
+	workspace.watchlist = NewWatchlist(watchlistPath)
+	workspace.subscriptions = NewNotifier(nil, subscriptionsPath)
+}
+
+// save writes the index to dir. The caller must hold s.mu.
+func (s *WorkspaceStore) save() {
+	if s.dir == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		lvapi.Error(context.Background(), "unable to encode workspaces", lvapi.F("error", err))
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, "index.json"), data, 0600); err != nil {
+		lvapi.Error(context.Background(), "unable to write workspaces", lvapi.F("path", s.dir), lvapi.F("error", err))
+	}
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// hashAPIKey returns the stored hash of key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey creates an API key granting role, named name. The caller must hold s.mu.
+func (s *WorkspaceStore) newAPIKey(workspace *Workspace, name string, role string) NewAPIKey {
+	key := NewAPIKey{APIKey: APIKey{ID: randomHex(4), Name: name, Role: role, Created: time.Now()}, Key: apiKeyPrefix + randomHex(24)}
+	key.Hash = hashAPIKey(key.Key)
+	workspace.Keys = append(workspace.Keys, key.APIKey)
+	key.Hash = ""
+	return key
+}
+
+// Create creates a workspace named name with an owner key.
+// It returns the created workspace and its owner key.
+func (s *WorkspaceStore) Create(name string) (*Workspace, NewAPIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workspace := &Workspace{ID: randomHex(6), Name: name, Created: time.Now()}
+	key := s.newAPIKey(workspace, "owner", RoleOwner)
+	s.open(workspace)
+	s.Workspaces[workspace.ID] = workspace
+	s.save()
+	return workspace, key
+}
+
+// Delete deletes the workspace with id, its watchlist, webhooks and keys.
+// It returns false if there is no such workspace.
+func (s *WorkspaceStore) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workspace, found := s.Workspaces[id]
+	if !found {
+		return false
+	}
+	delete(s.Workspaces, id)
+	s.save()
+	if s.dir != "" {
+		if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+			lvapi.Error(context.Background(), "unable to remove workspace", lvapi.F("workspace", id), lvapi.F("error", err))
+		}
+	}
+	// The poller stops checking the entries of the workspace
+	workspace.watchlist.signal()
+	return true
+}
+
+// Get returns the workspace with id, and false if there is no such workspace.
+func (s *WorkspaceStore) Get(id string) (*Workspace, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	workspace, found := s.Workspaces[id]
+	return workspace, found
+}
+
+// List returns every workspace, oldest first.
+func (s *WorkspaceStore) List() []*Workspace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*Workspace, 0, len(s.Workspaces))
+	for _, workspace := range s.Workspaces {
+		list = append(list, workspace)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// Len returns the number of workspaces.
+func (s *WorkspaceStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.Workspaces)
+}
+
+// Watchlists returns the watchlist of every workspace.
+func (s *WorkspaceStore) Watchlists() []*Watchlist {
+	var watchlists []*Watchlist
+	for _, workspace := range s.List() {
+		watchlists = append(watchlists, workspace.watchlist)
+	}
+	return watchlists
+}
+
+// WebhooksWatching returns the webhooks of every workspace watching sku in region.
+func (s *WorkspaceStore) WebhooksWatching(sku string, region string) []string {
+	var webhooks []string
+	for _, workspace := range s.List() {
+		if workspace.watchlist.Watches(sku, region) {
+			webhooks = append(webhooks, workspace.subscriptions.Webhooks()...)
+		}
+	}
+	return webhooks
+}
+
+// Authenticate returns the workspace and API key key belongs to, and false if it belongs to none.
+func (s *WorkspaceStore) Authenticate(key string) (*Workspace, APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hash := []byte(hashAPIKey(key))
+	for _, workspace := range s.Workspaces {
+		for _, apiKey := range workspace.Keys {
+			if subtle.ConstantTimeCompare(hash, []byte(apiKey.Hash)) == 1 {
+				return workspace, apiKey, true
+			}
+		}
+	}
+	return nil, APIKey{}, false
+}
+
+// Keys returns the API keys of workspace, without their hashes.
+func (s *WorkspaceStore) Keys(workspace *Workspace) []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []APIKey{}
+	for _, key := range workspace.Keys {
+		key.Hash = ""
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// AddKey creates an API key of workspace named name granting role.
+// It returns the created key.
+func (s *WorkspaceStore) AddKey(workspace *Workspace, name string, role string) NewAPIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.newAPIKey(workspace, name, role)
+	s.save()
+	return key
+}
+
+// Errors of RemoveKey
+var (
+	errUnknownKey   = errors.New("unknown API key")
+	errLastOwnerKey = errors.New("a workspace keeps at least one owner key")
+)
+
+// RemoveKey revokes the API key of workspace with id.
+// It returns errUnknownKey if there is no such key, and errLastOwnerKey if it is the last owner key.
+func (s *WorkspaceStore) RemoveKey(workspace *Workspace, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owners := 0
+	for _, key := range workspace.Keys {
+		if key.Role == RoleOwner {
+			owners++
+		}
+	}
+	for i, key := range workspace.Keys {
+		if key.ID != id {
+			continue
+		}
+		if key.Role == RoleOwner && owners == 1 {
+			return errLastOwnerKey
+		}
+		workspace.Keys = append(workspace.Keys[:i], workspace.Keys[i+1:]...)
+		s.save()
+		return nil
+	}
+	return errUnknownKey
+}
+
+// A principal represents who a request acts as: the role of its API key in a workspace, or the
+// administrator, who owns the default workspace.
+type principal struct {
+	workspace *Workspace // Workspace of the API key, nil for the default workspace
+	role      string     // Role in the workspace
+	admin     bool       // Whether the request acts as the administrator
+}
+
+// Context key of the principal of a request
+type principalKey struct{}
+
+// requestAPIKey returns the API key r was sent with, as a Bearer token or in the X-API-Key header.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// authenticate returns who r acts as. Requests without API key act as the administrator unless
+// an admin key is configured or a workspace exists, and requests with the admin key always do.
+// It returns false if r has no valid API key and one is required.
+func authenticate(r *http.Request) (principal, bool) {
+	adminKey := currentConfig().AdminKey
+	key := requestAPIKey(r)
+	if key == "" {
+		// Once workspaces hold keys, dropping the key must not grant more than sending it
+		return principal{role: RoleOwner, admin: true}, adminKey == "" && workspaces.Len() == 0
+	}
+	if adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1 {
+		return principal{role: RoleOwner, admin: true}, true
+	}
+	workspace, apiKey, found := workspaces.Authenticate(key)
+	if !found {
+		return principal{}, false
+	}
+	return principal{workspace: workspace, role: apiKey.Role}, true
+}
+
+// requireRole serves r with next if its API key grants role, or the administrator role for
+// roleAdmin, and answers 401 or 403 otherwise. Handlers find who the request acts as with
+// requestPrincipal. An empty role serves every request.
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	if role == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := authenticate(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "A valid API key is required", false)
+			return
+		}
+		if (role == roleAdmin && !p.admin) || roleRanks[p.role] < roleRanks[role] {
+			writeError(w, http.StatusForbidden, CodeForbidden, "The API key does not grant the "+role+" role", false)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// requestPrincipal returns who r acts as, as set by requireRole.
+func requestPrincipal(r *http.Request) principal {
+	p, _ := r.Context().Value(principalKey{}).(principal)
+	return p
+}
+
+// watchlist returns the watchlist of the workspace p acts in.
+func (p principal) watchlist() *Watchlist {
+	if p.workspace == nil {
+		return watchlist
+	}
+	return p.workspace.watchlist
+}
+
+// subscriptions returns the webhooks of the workspace p acts in.
+func (p principal) subscriptions() *Notifier {
+	if p.workspace == nil {
+		return notifier
+	}
+	return p.workspace.subscriptions
+}
+
+// views returns whether the workspace p acts in views the history of sku in region, in any region
+// if region is empty: the default workspace views every sku, other workspaces those they watch.
+func (p principal) views(sku string, region string) bool {
+	return p.workspace == nil || p.workspace.watchlist.Watches(sku, region)
+}
+
+// info returns the API representation of the workspace p acts in.
+func (p principal) info() WorkspaceInfo {
+	info := WorkspaceInfo{ID: defaultWorkspaceID, Name: defaultWorkspaceID, Role: p.role}
+	if p.workspace != nil {
+		info.ID, info.Name, info.Created = p.workspace.ID, p.workspace.Name, p.workspace.Created
+	}
+	info.Entries, info.Webhooks = len(p.watchlist().List()), len(p.subscriptions().Webhooks())
+	return info
+}
+
+func returnWorkspaces(w http.ResponseWriter, r *http.Request) {
+	list := []WorkspaceInfo{}
+	for _, workspace := range workspaces.List() {
+		list = append(list, principal{workspace: workspace}.info())
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func createWorkspace(w http.ResponseWriter, r *http.Request) {
+	if currentConfig().AdminKey == "" {
+		writeError(w, http.StatusForbidden, CodeForbidden, "Workspaces require an admin_key to be configured", false)
+		return
+	}
+	var request WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || strings.TrimSpace(request.Name) == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Workspace requires a Name", false)
+		return
+	}
+	workspace, key := workspaces.Create(strings.TrimSpace(request.Name))
+	lvapi.Info(r.Context(), "workspace created", lvapi.F("workspace", workspace.ID))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreatedWorkspace{Workspace: principal{workspace: workspace, role: RoleOwner}.info(), Key: key})
+}
+
+func deleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !workspaces.Delete(vars["workspace"]) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown workspace: "+vars["workspace"], false)
+		return
+	}
+	lvapi.Info(r.Context(), "workspace deleted", lvapi.F("workspace", vars["workspace"]))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func returnWorkspace(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(requestPrincipal(r).info())
+}
+
+func deleteOwnWorkspace(w http.ResponseWriter, r *http.Request) {
+	p := requestPrincipal(r)
+	if p.workspace == nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "The default workspace cannot be deleted", false)
+		return
+	}
+	workspaces.Delete(p.workspace.ID)
+	lvapi.Info(r.Context(), "workspace deleted", lvapi.F("workspace", p.workspace.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func returnAPIKeys(w http.ResponseWriter, r *http.Request) {
+	p := requestPrincipal(r)
+	if p.workspace == nil {
+		json.NewEncoder(w).Encode([]APIKey{})
+		return
+	}
+	json.NewEncoder(w).Encode(workspaces.Keys(p.workspace))
+}
+
+func addAPIKey(w http.ResponseWriter, r *http.Request) {
+	p := requestPrincipal(r)
+	if p.workspace == nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "The default workspace is accessed with the configured admin key", false)
+		return
+	}
+	var request APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || roleRanks[request.Role] == 0 {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "API key requires a Role: owner, editor or viewer", false)
+		return
+	}
+	key := workspaces.AddKey(p.workspace, strings.TrimSpace(request.Name), request.Role)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+func removeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	p := requestPrincipal(r)
+	if p.workspace == nil {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown API key: "+vars["id"], false)
+		return
+	}
+	switch err := workspaces.RemoveKey(p.workspace, vars["id"]); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errUnknownKey:
+		writeError(w, http.StatusNotFound, CodeNotFound, "Unknown API key: "+vars["id"], false)
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Unable to revoke the API key: "+err.Error(), false)
+	}
+}